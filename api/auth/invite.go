@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DGISsoft/DGISback/env"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const inviteAudience = "dgis-invite"
+
+var ErrInvalidInvite = errors.New("invite token is invalid or expired")
+
+// GenerateInviteToken подписывает ссылку-приглашение тем же ключом, что и access-токены.
+// Токен несёт только ID приглашения; однократность проверяется по состоянию приглашения в базе.
+func (manager *JWTManager) GenerateInviteToken(inviteID string, expiresAt time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{
+		ID:        inviteID,
+		Audience:  jwt.ClaimStrings{inviteAudience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+
+	return manager.sign(claims)
+}
+
+func (manager *JWTManager) VerifyInviteToken(tokenString string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, manager.keyFunc, jwt.WithAudience(inviteAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidInvite, err)
+	}
+
+	return claims.ID, nil
+}
+
+func GetInviteDuration() time.Duration {
+	duration := 72 * time.Hour
+
+	if durationStr := env.GetEnv("INVITE_DURATION", ""); durationStr != "" {
+		if d, err := time.ParseDuration(durationStr); err == nil {
+			duration = d
+		}
+	}
+	return duration
+}
+
+// InviteURL собирает ссылку для приглашённого, если задан INVITE_URL_BASE, например
+// https://dgis.example/invite?token=
+func InviteURL(token string) string {
+	base := env.GetEnv("INVITE_URL_BASE", "")
+	if base == "" {
+		return ""
+	}
+	return base + token
+}
@@ -20,47 +20,113 @@ type JWTClaims struct {
 	Login    string          `json:"login"`
 	Role     models.UserRole `json:"role"`
 	FullName string          `json:"full_name"`
+	// Пока флаг установлен, доступны только операции смены пароля
+	MustChangePassword bool `json:"pwd_change,omitempty"`
+	// Политика требует 2FA, а пользователь её ещё не подключил: доступно только подключение
+	TwoFactorSetupRequired bool `json:"tfa_setup,omitempty"`
+	// Заполняются только для запросов по API-ключу, в токен не попадают
+	APIKeyID string               `json:"-"`
+	Scopes   []models.APIKeyScope `json:"-"`
 	jwt.RegisteredClaims
 }
 
+func (c *JWTClaims) SessionID() string {
+	return c.ID
+}
+
+func (c *JWTClaims) IsAPIKey() bool {
+	return c.APIKeyID != ""
+}
+
+func (c *JWTClaims) HasScope(scope models.APIKeyScope) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAPIKeyClaims описывает принципала API-ключа: он действует от имени владельца ключа
+// с ролью ключа, уже ограниченной текущей ролью владельца, и только в пределах выданных scopes
+func NewAPIKeyClaims(key *models.APIKey) *JWTClaims {
+	return &JWTClaims{
+		UserID:   key.OwnerID.Hex(),
+		Login:    "api-key:" + key.Prefix,
+		Role:     key.Role,
+		FullName: key.Name,
+		APIKeyID: key.ID.Hex(),
+		Scopes:   key.Scopes,
+	}
+}
+
 type JWTManager struct {
-	secretKey     string
+	keys          *KeySet
 	tokenDuration time.Duration
 }
 
-func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
-	return &JWTManager{secretKey: secretKey, tokenDuration: tokenDuration}
+func NewJWTManager(keys *KeySet, tokenDuration time.Duration) *JWTManager {
+	return &JWTManager{keys: keys, tokenDuration: tokenDuration}
+}
+
+func (manager *JWTManager) KeySet() *KeySet {
+	return manager.keys
 }
 
-func (manager *JWTManager) GenerateToken(user *models.User) (string, error) {
+// GenerateToken выпускает токен для сессии sessionID, которая передаётся в claim jti
+func (manager *JWTManager) GenerateToken(user *models.User, sessionID string, twoFactorSetupRequired bool) (string, error) {
 	expirationTime := time.Now().Add(manager.tokenDuration)
 
 	claims := JWTClaims{
-		UserID:   user.ID.Hex(),
-		Login:    user.Login,
-		Role:     user.Role,
-		FullName: user.FullName,
+		UserID:             user.ID.Hex(),
+		Login:              user.Login,
+		Role:               user.Role,
+		FullName:           user.FullName,
+		MustChangePassword: user.MustChangePassword,
+		TwoFactorSetupRequired: twoFactorSetupRequired,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return manager.sign(claims)
+}
+
+func (manager *JWTManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	// Токены без kid выпускались до ротации ключей и подписаны секретом
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = secretKeyID
+	}
+
+	key, ok := manager.keys.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+func (manager *JWTManager) sign(claims jwt.Claims) (string, error) {
+	active := manager.keys.active
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.kid
 
-	return token.SignedString([]byte(manager.secretKey))
+	return token.SignedString(active.private)
 }
 
 func (manager *JWTManager) VerifyToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		
-		return []byte(manager.secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, manager.keyFunc)
 	
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpiredToken
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -70,6 +136,11 @@ func (manager *JWTManager) VerifyToken(tokenString string) (*JWTClaims, error) {
 		return nil, ErrInvalidToken
 	}
 	
+	// Токены с audience (приглашения и т.п.) не являются access-токенами
+	if len(claims.Audience) > 0 {
+		return nil, ErrInvalidToken
+	}
+	
 	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(time.Now()) {
 		return nil, ErrExpiredToken
 	}
@@ -77,14 +148,9 @@ func (manager *JWTManager) VerifyToken(tokenString string) (*JWTClaims, error) {
 	return claims, nil
 }
 
-func GetSecretKey() string {
-	secret := env.GetEnv("JWT_SECRET","default-secret-key-change-in-production")
-	return secret
-}
-
-
+// GetTokenDuration возвращает время жизни access-токена; продлевается через refresh-токен
 func GetTokenDuration() time.Duration {
-	duration := 24 * time.Hour
+	duration := 15 * time.Minute
 	
 	if durationStr := env.GetEnv("JWT_DURATION",""); durationStr != "" {
 		if d, err := time.ParseDuration(durationStr); err == nil {
@@ -92,4 +158,15 @@ func GetTokenDuration() time.Duration {
 		}
 	}	
 	return duration
-}
\ No newline at end of file
+}
+
+func GetRefreshTokenDuration() time.Duration {
+	duration := 7 * 24 * time.Hour
+
+	if durationStr := env.GetEnv("REFRESH_TOKEN_DURATION", ""); durationStr != "" {
+		if d, err := time.ParseDuration(durationStr); err == nil {
+			duration = d
+		}
+	}
+	return duration
+}
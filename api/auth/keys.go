@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DGISsoft/DGISback/env"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultSecretKey = "default-secret-key-change-in-production"
+	// kid симметричного ключа; в JWKS не публикуется
+	secretKeyID   = "secret"
+	minRSAKeyBits = 2048
+)
+
+var ErrDefaultSecret = errors.New("JWT_SECRET is not set or uses the default value; configure JWT_KEYS_DIR or set APP_ENV=development")
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	// Для асимметричных ключей private может отсутствовать: такой ключ только проверяет подписи
+	private any
+	public  any
+}
+
+// KeySet хранит ключ, которым подписываются новые токены, и все ключи, которыми
+// ещё можно проверить выданные токены. При ротации старый ключ остаётся в наборе
+// как публичный, пока не истекут подписанные им токены.
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+func newKeySet() *KeySet {
+	return &KeySet{keys: map[string]*signingKey{}}
+}
+
+func (ks *KeySet) add(key *signingKey) {
+	ks.keys[key.kid] = key
+}
+
+func (ks *KeySet) ActiveKeyID() string {
+	return ks.active.kid
+}
+
+func (ks *KeySet) lookup(kid string) (*signingKey, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// LoadKeySet собирает ключи подписи из окружения.
+//
+// JWT_KEYS_DIR — каталог с PEM-файлами <kid>.pem: закрытые ключи RSA или Ed25519 (PKCS#8/PKCS#1)
+// могут подписывать, открытые (PKIX) только проверяют. JWT_SIGNING_KEY_ID выбирает ключ подписи,
+// если закрытых ключей несколько.
+//
+// Без JWT_KEYS_DIR используется HS256 с JWT_SECRET. Секрет по умолчанию допускается только
+// при APP_ENV=development.
+func LoadKeySet() (*KeySet, error) {
+	if dir := env.GetEnv("JWT_KEYS_DIR", ""); dir != "" {
+		return loadKeySetFromDir(dir, env.GetEnv("JWT_SIGNING_KEY_ID", ""))
+	}
+
+	secret := env.GetEnv("JWT_SECRET", "")
+	if secret == "" || secret == defaultSecretKey {
+		if !env.IsDevelopment() {
+			return nil, ErrDefaultSecret
+		}
+		log.Println("Auth: WARNING - signing tokens with the default JWT secret, development mode only")
+		secret = defaultSecretKey
+	}
+
+	ks := newKeySet()
+	key := &signingKey{kid: secretKeyID, method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	ks.add(key)
+	ks.active = key
+	return ks, nil
+}
+
+func loadKeySetFromDir(dir, activeKID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys in %s: %w", dir, err)
+	}
+	sort.Strings(files)
+
+	ks := newKeySet()
+	var signers []*signingKey
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", file, err)
+		}
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", file, err)
+		}
+		ks.add(key)
+		if key.private != nil {
+			signers = append(signers, key)
+		}
+	}
+
+	switch {
+	case activeKID != "":
+		key, ok := ks.lookup(activeKID)
+		if !ok || key.private == nil {
+			return nil, fmt.Errorf("signing key %q not found or has no private part in %s", activeKID, dir)
+		}
+		ks.active = key
+	case len(signers) == 1:
+		ks.active = signers[0]
+	case len(signers) == 0:
+		return nil, fmt.Errorf("no private keys found in %s", dir)
+	default:
+		return nil, fmt.Errorf("several private keys in %s, set JWT_SIGNING_KEY_ID", dir)
+	}
+
+	log.Printf("Auth: Loaded %d JWT keys, signing with %q (%s)", len(ks.keys), ks.active.kid, ks.active.method.Alg())
+	return ks, nil
+}
+
+func parseKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var raw any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		raw, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		raw, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		raw, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := raw.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", raw)
+	}
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые части асимметричных ключей; симметричный секрет не публикуется
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{KeyID: kid, Use: "sig", Algorithm: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func pemBlock(t *testing.T, blockType string, der []byte) []byte {
+	t.Helper()
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func privateKeyPEM(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	return pemBlock(t, "PRIVATE KEY", der)
+}
+
+func publicKeyPEM(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	return pemBlock(t, "PUBLIC KEY", der)
+}
+
+func writeKeys(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	weakRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		alg     string
+		private bool
+		wantErr bool
+	}{
+		{"RSA PKCS#8", privateKeyPEM(t, rsaKey), "RS256", true, false},
+		{"RSA PKCS#1", pemBlock(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), "RS256", true, false},
+		{"RSA public", publicKeyPEM(t, &rsaKey.PublicKey), "RS256", false, false},
+		{"Ed25519 private", privateKeyPEM(t, edPrivate), "EdDSA", true, false},
+		{"Ed25519 public", publicKeyPEM(t, edPublic), "EdDSA", false, false},
+		{"weak RSA", privateKeyPEM(t, weakRSAKey), "", false, true},
+		{"not PEM", []byte("secret"), "", false, true},
+		{"certificate", pemBlock(t, "CERTIFICATE", []byte{1}), "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseKey("k1", tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKey error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if key.kid != "k1" || key.method.Alg() != tt.alg || (key.private != nil) != tt.private || key.public == nil {
+				t.Errorf("parseKey = kid %q alg %s private %v", key.kid, key.method.Alg(), key.private != nil)
+			}
+		})
+	}
+}
+
+func TestLoadKeySetFromDir(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+
+	dir := writeKeys(t, map[string][]byte{
+		"2025-01.pem": publicKeyPEM(t, &rsaKey.PublicKey),
+		"2025-02.pem": privateKeyPEM(t, edPrivate),
+	})
+	ks, err := loadKeySetFromDir(dir, "")
+	if err != nil {
+		t.Fatalf("loadKeySetFromDir: %v", err)
+	}
+	if ks.ActiveKeyID() != "2025-02" || len(ks.keys) != 2 {
+		t.Errorf("active %q with %d keys, want 2025-02 with 2", ks.ActiveKeyID(), len(ks.keys))
+	}
+
+	if _, err := loadKeySetFromDir(dir, "2025-01"); err == nil {
+		t.Error("public-only key must not be selected for signing")
+	}
+
+	several := writeKeys(t, map[string][]byte{
+		"a.pem": privateKeyPEM(t, rsaKey),
+		"b.pem": privateKeyPEM(t, edPrivate),
+	})
+	if _, err := loadKeySetFromDir(several, ""); err == nil || !strings.Contains(err.Error(), "JWT_SIGNING_KEY_ID") {
+		t.Errorf("several private keys without JWT_SIGNING_KEY_ID: error = %v", err)
+	}
+	if ks, err := loadKeySetFromDir(several, "a"); err != nil || ks.ActiveKeyID() != "a" {
+		t.Errorf("loadKeySetFromDir with kid a = %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+
+	ks := newKeySet()
+	ks.add(&signingKey{kid: secretKeyID, method: jwt.SigningMethodHS256, private: []byte("s"), public: []byte("s")})
+	ks.add(&signingKey{kid: "rsa", method: jwt.SigningMethodRS256, private: rsaKey, public: &rsaKey.PublicKey})
+	ks.add(&signingKey{kid: "ed", method: jwt.SigningMethodEdDSA, public: edPublic})
+
+	keys := ks.JWKS().Keys
+	if len(keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2 without the secret: %+v", len(keys), keys)
+	}
+
+	ed, rsaJWK := keys[0], keys[1]
+	if ed.KeyID != "ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(ed.X); string(x) != string(edPublic) {
+		t.Errorf("Ed25519 x does not match the public key")
+	}
+
+	if rsaJWK.KeyID != "rsa" || rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	e, _ := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	if new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(rsaKey.E) {
+		t.Errorf("RSA n/e do not match the public key")
+	}
+}
+
+func TestVerifyTokenAfterRotation(t *testing.T) {
+	_, oldPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	_, newPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	user := &models.User{ID: primitive.NewObjectID(), Login: "ivanov", Role: models.UserRoleStarosta}
+
+	before, err := loadKeySetFromDir(writeKeys(t, map[string][]byte{"old.pem": privateKeyPEM(t, oldPrivate)}), "")
+	if err != nil {
+		t.Fatalf("load keys before rotation: %v", err)
+	}
+	oldToken, err := NewJWTManager(before, time.Minute).GenerateToken(user, "session", false)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	// После ротации старый ключ остаётся только открытым
+	after, err := loadKeySetFromDir(writeKeys(t, map[string][]byte{
+		"old.pem": publicKeyPEM(t, oldPrivate.Public()),
+		"new.pem": privateKeyPEM(t, newPrivate),
+	}), "")
+	if err != nil {
+		t.Fatalf("load keys after rotation: %v", err)
+	}
+	manager := NewJWTManager(after, time.Minute)
+
+	claims, err := manager.VerifyToken(oldToken)
+	if err != nil {
+		t.Fatalf("token signed with the rotated-out key: %v", err)
+	}
+	if claims.UserID != user.ID.Hex() || claims.SessionID() != "session" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	newToken, err := manager.GenerateToken(user, "session", false)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := manager.VerifyToken(newToken); err != nil {
+		t.Errorf("token signed with the new key: %v", err)
+	}
+
+	// Ключ полностью выведен из набора: его токены больше не принимаются
+	retired, err := loadKeySetFromDir(writeKeys(t, map[string][]byte{"new.pem": privateKeyPEM(t, newPrivate)}), "")
+	if err != nil {
+		t.Fatalf("load keys after retirement: %v", err)
+	}
+	if _, err := NewJWTManager(retired, time.Minute).VerifyToken(oldToken); err == nil {
+		t.Error("token signed with a removed key must be rejected")
+	}
+}
+
+func TestVerifyTokenRejectsAlgorithmMismatch(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	ks, err := loadKeySetFromDir(writeKeys(t, map[string][]byte{"ed.pem": privateKeyPEM(t, private)}), "")
+	if err != nil {
+		t.Fatalf("loadKeySetFromDir: %v", err)
+	}
+
+	// HS256 с открытым ключом в роли секрета и kid асимметричного ключа
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{
+		UserID:           primitive.NewObjectID().Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	token.Header["kid"] = "ed"
+	signed, err := token.SignedString([]byte(private.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, err := NewJWTManager(ks, time.Minute).VerifyToken(signed); err == nil {
+		t.Error("token with a mismatched algorithm must be rejected")
+	}
+}
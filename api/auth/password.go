@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/DGISsoft/DGISback/env"
+)
+
+var ErrWeakPassword = errors.New("password does not satisfy the password policy")
+
+// Самые частые пароли из утечек; дополняется файлом PASSWORD_DENYLIST_FILE
+var defaultPasswordDenylist = []string{
+	"123456", "12345678", "123456789", "1234567890", "111111", "000000", "123123",
+	"password", "password1", "password123", "qwerty", "qwerty123", "qwertyuiop",
+	"1q2w3e4r", "1q2w3e4r5t", "zaq12wsx", "abc123", "iloveyou", "admin", "admin123",
+	"administrator", "letmein", "welcome", "monkey", "dragon", "football", "starosta",
+	"dgis", "dgis2024", "dgis2025", "obshaga", "student", "parol", "parol123",
+}
+
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	denylist      map[string]struct{}
+}
+
+func GetPasswordPolicy() *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:     env.GetEnv("PASSWORD_MIN_LENGTH", 10),
+		RequireUpper:  env.GetEnv("PASSWORD_REQUIRE_UPPER", true),
+		RequireLower:  env.GetEnv("PASSWORD_REQUIRE_LOWER", true),
+		RequireDigit:  env.GetEnv("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol: env.GetEnv("PASSWORD_REQUIRE_SYMBOL", false),
+		denylist:      make(map[string]struct{}, len(defaultPasswordDenylist)),
+	}
+
+	for _, password := range defaultPasswordDenylist {
+		policy.denylist[password] = struct{}{}
+	}
+
+	if path := env.GetEnv("PASSWORD_DENYLIST_FILE", ""); path != "" {
+		if err := policy.loadDenylist(path); err != nil {
+			log.Printf("PasswordPolicy: Failed to load denylist %s: %v", path, err)
+		}
+	}
+
+	return policy
+}
+
+func (p *PasswordPolicy) loadDenylist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			p.denylist[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+// Validate проверяет пароль; personal — логин и прочие данные пользователя, которые нельзя включать в пароль
+func (p *PasswordPolicy) Validate(password string, personal ...string) error {
+	var problems []string
+
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		problems = append(problems, "an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		problems = append(problems, "a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		problems = append(problems, "a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		problems = append(problems, "a special character")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: must contain %s", ErrWeakPassword, strings.Join(problems, ", "))
+	}
+
+	lowered := strings.ToLower(password)
+	if _, denied := p.denylist[lowered]; denied {
+		return fmt.Errorf("%w: password is too common", ErrWeakPassword)
+	}
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimPrefix(value, "@"))
+		if len(value) >= 3 && strings.Contains(lowered, value) {
+			return fmt.Errorf("%w: password must not contain your personal data", ErrWeakPassword)
+		}
+	}
+
+	return nil
+}
+
+const (
+	temporaryPasswordLength = 16
+	upperChars              = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	lowerChars              = "abcdefghijkmnopqrstuvwxyz"
+	digitChars              = "23456789"
+	symbolChars             = "!@#$%^&*-_=+?"
+)
+
+// GenerateTemporaryPassword выдаёт одноразовый пароль, заведомо проходящий политику
+func (p *PasswordPolicy) GenerateTemporaryPassword() (string, error) {
+	length := max(temporaryPasswordLength, p.MinLength)
+	all := upperChars + lowerChars + digitChars + symbolChars
+
+	// По одному символу каждого класса, остальное из общего алфавита
+	password := make([]byte, 0, length)
+	for _, charset := range []string{upperChars, lowerChars, digitChars, symbolChars} {
+		c, err := randomChar(charset)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+	for len(password) < length {
+		c, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	return string(password), nil
+}
+
+func randomChar(charset string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate password: %w", err)
+	}
+	return charset[n.Int64()], nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DGISsoft/DGISback/env"
+)
+
+var (
+	ErrTelegramNotConfigured = errors.New("telegram login is not configured")
+	ErrTelegramHashInvalid   = errors.New("telegram login data has an invalid hash")
+	ErrTelegramAuthExpired   = errors.New("telegram login data is too old")
+)
+
+// TelegramLoginData — данные, которые Telegram Login Widget передаёт после авторизации
+type TelegramLoginData struct {
+	ID        string
+	FirstName string
+	LastName  string
+	Username  string
+	PhotoURL  string
+	AuthDate  int64
+	Hash      string
+}
+
+// dataCheckString собирает строку проверки: поля кроме hash в алфавитном порядке, по одному на строку
+func (d *TelegramLoginData) dataCheckString() string {
+	fields := map[string]string{
+		"id":         d.ID,
+		"first_name": d.FirstName,
+		"last_name":  d.LastName,
+		"username":   d.Username,
+		"photo_url":  d.PhotoURL,
+		"auth_date":  fmt.Sprint(d.AuthDate),
+	}
+
+	lines := make([]string, 0, len(fields))
+	for key, value := range fields {
+		if value != "" {
+			lines = append(lines, key+"="+value)
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// TelegramVerifier проверяет подпись данных виджета токеном бота
+// (https://core.telegram.org/widgets/login#checking-authorization)
+type TelegramVerifier struct {
+	botToken string
+	maxAge   time.Duration
+	now      func() time.Time
+}
+
+func NewTelegramVerifier(botToken string, maxAge time.Duration) *TelegramVerifier {
+	return &TelegramVerifier{botToken: botToken, maxAge: maxAge, now: time.Now}
+}
+
+func GetTelegramVerifier() *TelegramVerifier {
+	maxAge := 10 * time.Minute
+
+	if maxAgeStr := env.GetEnv("TELEGRAM_AUTH_MAX_AGE", ""); maxAgeStr != "" {
+		if d, err := time.ParseDuration(maxAgeStr); err == nil {
+			maxAge = d
+		}
+	}
+	return NewTelegramVerifier(env.GetEnv("TELEGRAM_BOT_TOKEN", ""), maxAge)
+}
+
+func (v *TelegramVerifier) sign(data *TelegramLoginData) string {
+	secret := sha256.Sum256([]byte(v.botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(data.dataCheckString()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (v *TelegramVerifier) Verify(data *TelegramLoginData) error {
+	if v.botToken == "" {
+		return ErrTelegramNotConfigured
+	}
+
+	if data.ID == "" || !hmac.Equal([]byte(v.sign(data)), []byte(strings.ToLower(data.Hash))) {
+		return ErrTelegramHashInvalid
+	}
+
+	authDate := time.Unix(data.AuthDate, 0)
+	if v.now().Sub(authDate) > v.maxAge || authDate.After(v.now().Add(time.Minute)) {
+		return ErrTelegramAuthExpired
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Фикстуры подписаны токеном testBotToken по алгоритму Telegram Login Widget
+const testBotToken = "123456789:TEST-bot-token"
+
+var testAuthDate = time.Unix(1760000000, 0)
+
+func signedFullPayload() *TelegramLoginData {
+	return &TelegramLoginData{
+		ID:        "987654321",
+		FirstName: "Иван",
+		LastName:  "Петров",
+		Username:  "ivan_petrov",
+		PhotoURL:  "https://t.me/i/userpic/320/ivan.jpg",
+		AuthDate:  testAuthDate.Unix(),
+		Hash:      "49723ab7deb83fff43b99761f21d50c0e323de1333ca26e08a1a07b0b51203b3",
+	}
+}
+
+func signedMinimalPayload() *TelegramLoginData {
+	return &TelegramLoginData{
+		ID:        "987654321",
+		FirstName: "Иван",
+		AuthDate:  testAuthDate.Unix(),
+		Hash:      "53d22172ba31fd2eb21d170bb24c999c18b42063adaa851e177e34f8504f07a7",
+	}
+}
+
+func testVerifier(now time.Time) *TelegramVerifier {
+	v := NewTelegramVerifier(testBotToken, 10*time.Minute)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestTelegramVerifyValid(t *testing.T) {
+	v := testVerifier(testAuthDate.Add(time.Minute))
+
+	if err := v.Verify(signedFullPayload()); err != nil {
+		t.Errorf("full payload: %v", err)
+	}
+	if err := v.Verify(signedMinimalPayload()); err != nil {
+		t.Errorf("payload without optional fields: %v", err)
+	}
+}
+
+func TestTelegramVerifyTampered(t *testing.T) {
+	v := testVerifier(testAuthDate.Add(time.Minute))
+
+	payload := signedFullPayload()
+	payload.Username = "someone_else"
+	if err := v.Verify(payload); !errors.Is(err, ErrTelegramHashInvalid) {
+		t.Errorf("tampered username: got %v, want ErrTelegramHashInvalid", err)
+	}
+
+	payload = signedFullPayload()
+	payload.ID = "1"
+	if err := v.Verify(payload); !errors.Is(err, ErrTelegramHashInvalid) {
+		t.Errorf("tampered id: got %v, want ErrTelegramHashInvalid", err)
+	}
+
+	other := NewTelegramVerifier("42:another-bot", 10*time.Minute)
+	other.now = v.now
+	if err := other.Verify(signedFullPayload()); !errors.Is(err, ErrTelegramHashInvalid) {
+		t.Errorf("other bot token: got %v, want ErrTelegramHashInvalid", err)
+	}
+}
+
+func TestTelegramVerifyFreshness(t *testing.T) {
+	if err := testVerifier(testAuthDate.Add(11 * time.Minute)).Verify(signedFullPayload()); !errors.Is(err, ErrTelegramAuthExpired) {
+		t.Errorf("stale payload: got %v, want ErrTelegramAuthExpired", err)
+	}
+	if err := testVerifier(testAuthDate.Add(-5 * time.Minute)).Verify(signedFullPayload()); !errors.Is(err, ErrTelegramAuthExpired) {
+		t.Errorf("payload from the future: got %v, want ErrTelegramAuthExpired", err)
+	}
+}
+
+func TestTelegramVerifyNotConfigured(t *testing.T) {
+	v := NewTelegramVerifier("", 10*time.Minute)
+	if err := v.Verify(signedFullPayload()); !errors.Is(err, ErrTelegramNotConfigured) {
+		t.Errorf("got %v, want ErrTelegramNotConfigured", err)
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// Тестовые векторы RFC 6238, приложение B (SHA1, 8 цифр)
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		if got := hotp(key, uint64(v.unix/totpPeriod), 8); got != v.code {
+			t.Errorf("hotp at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+
+	// Шестизначный код — последние 6 цифр восьмизначного вектора
+	step, ok := ValidateTOTP(secret, "081804", now)
+	if !ok || step != 1111111109/totpPeriod {
+		t.Fatalf("ValidateTOTP = %d, %v; want current step", step, ok)
+	}
+
+	if _, ok := ValidateTOTP(secret, "081804", now.Add(totpPeriod*time.Second)); !ok {
+		t.Error("code from the previous step should be accepted")
+	}
+	if _, ok := ValidateTOTP(secret, "081804", now.Add(3*totpPeriod*time.Second)); ok {
+		t.Error("code outside the skew window should be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "000000", now); ok {
+		t.Error("wrong code should be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodes || len(hashes) != recoveryCodes {
+		t.Fatalf("got %d codes and %d hashes", len(codes), len(hashes))
+	}
+	if HashRecoveryCode(" "+codes[0]+" ") != hashes[0] {
+		t.Error("recovery code hash should ignore surrounding spaces")
+	}
+}
@@ -0,0 +1,87 @@
+// linkcheck сверяет markers.assignedUserIds, users.assignedMarkers и users.building.
+// По умолчанию только печатает дифф исправлений и завершается с кодом 1, если есть расхождения;
+// с -fix применяет исправления одной транзакцией. Код 2 — ошибка подключения или проверки.
+// На MongoDB без replica set транзакции недоступны, и -fix требует -allow-non-transactional
+// (или MONGO_ALLOW_NON_TRANSACTIONAL=true): исправления тогда применяются не атомарно.
+//
+//	go run ./cmd/linkcheck [-uri mongodb://localhost:27017] [-db dgis-db] [-fix] [-allow-non-transactional]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/DGISsoft/DGISback/env"
+	serv "github.com/DGISsoft/DGISback/services/mongo"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	uri := flag.String("uri", "mongodb://localhost:27017", "MongoDB connection URI")
+	dbName := flag.String("db", "dgis-db", "database name")
+	fix := flag.Bool("fix", false, "apply fixes instead of printing a dry-run diff")
+	timeout := flag.Duration("timeout", 5*time.Minute, "overall timeout")
+	allowNonTransactional := flag.Bool("allow-non-transactional", env.GetEnv("MONGO_ALLOW_NON_TRANSACTIONAL", false),
+		"apply fixes without a transaction on MongoDB without a replica set")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(*uri))
+	if err != nil {
+		log.Printf("Failed to connect to MongoDB: %v", err)
+		return 2
+	}
+	defer func() {
+		if err := client.Disconnect(context.Background()); err != nil {
+			log.Printf("Error disconnecting from MongoDB: %v", err)
+		}
+	}()
+
+	mongoService := serv.New(client.Database(*dbName))
+	mongoService.AllowNonTransactional(*allowNonTransactional)
+	markerService := serv.NewMarkerService(mongoService)
+
+	var report *serv.LinkReport
+	if *fix {
+		report, err = markerService.RepairLinks(ctx)
+	} else {
+		report, err = markerService.CheckLinks(ctx)
+	}
+	if errors.Is(err, serv.ErrTransactionsUnsupported) {
+		log.Printf("linkcheck failed: %v. Run MongoDB as a replica set or pass -allow-non-transactional "+
+			"(MONGO_ALLOW_NON_TRANSACTIONAL=true) to apply fixes without a transaction", err)
+		return 2
+	}
+	if err != nil {
+		log.Printf("linkcheck failed: %v", err)
+		return 2
+	}
+
+	for _, issue := range report.Issues {
+		fmt.Printf("%-18s %s\n", issue.Kind, issue.Fix())
+	}
+	fmt.Printf("scanned %d markers, %d users: %d issues", report.MarkersScanned, report.UsersScanned, len(report.Issues))
+
+	switch {
+	case len(report.Issues) == 0:
+		fmt.Println()
+	case *fix:
+		fmt.Println(", fixed")
+	default:
+		fmt.Println(", run with -fix to apply")
+		return 1
+	}
+	return 0
+}
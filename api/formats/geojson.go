@@ -0,0 +1,107 @@
+package formats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	ErrNotFeatureCollection = errors.New("file is not a GeoJSON FeatureCollection")
+	ErrNotPoint             = errors.New("feature geometry must be a Point")
+)
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type string `json:"type"`
+	// По спецификации id — строка или число
+	ID         any            `json:"id,omitempty"`
+	Geometry   *Geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func NewFeatureCollection(features []Feature) *FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+	return &FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// NewPointFeature строит точку из position в нашем порядке [широта, долгота];
+// в GeoJSON координаты записываются как [долгота, широта]
+func NewPointFeature(id string, position []float64, properties map[string]any) Feature {
+	var coordinates []float64
+	if len(position) == 2 {
+		coordinates = []float64{position[1], position[0]}
+	}
+	raw, _ := json.Marshal(coordinates)
+	return Feature{
+		Type:       "Feature",
+		ID:         id,
+		Geometry:   &Geometry{Type: "Point", Coordinates: raw},
+		Properties: properties,
+	}
+}
+
+// ReadFeatureCollection разбирает FeatureCollection; maxFeatures ограничивает число объектов
+func ReadFeatureCollection(r io.Reader, maxFeatures int) (*FeatureCollection, error) {
+	var collection FeatureCollection
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, ErrNotFeatureCollection
+	}
+	if maxFeatures > 0 && len(collection.Features) > maxFeatures {
+		return nil, fmt.Errorf("too many features: %d, at most %d allowed", len(collection.Features), maxFeatures)
+	}
+	return &collection, nil
+}
+
+// Position возвращает координаты точки в порядке [широта, долгота]. Высота, если она есть, отбрасывается.
+func (f Feature) Position() ([]float64, error) {
+	if f.Geometry == nil || f.Geometry.Type != "Point" {
+		return nil, ErrNotPoint
+	}
+
+	var coordinates []float64
+	if err := json.Unmarshal(f.Geometry.Coordinates, &coordinates); err != nil || len(coordinates) < 2 || len(coordinates) > 3 {
+		return nil, fmt.Errorf("point coordinates must be [longitude, latitude]")
+	}
+	return []float64{coordinates[1], coordinates[0]}, nil
+}
+
+// StringProperty возвращает строковое свойство; числа приводятся к строке, чтобы markerId вида 12 тоже читался
+func (f Feature) StringProperty(name string) string {
+	return stringValue(f.Properties[name])
+}
+
+// StringID возвращает id объекта как строку
+func (f Feature) StringID() string {
+	return stringValue(f.ID)
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return fmt.Sprintf("%d", int64(v))
+		}
+		return fmt.Sprintf("%g", v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,62 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPointFeatureRoundTrip(t *testing.T) {
+	feature := NewPointFeature("b1", []float64{55.7558, 37.6173}, map[string]any{"label": "Корпус 1"})
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(NewFeatureCollection([]Feature{feature})); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"coordinates":[37.6173,55.7558]`) {
+		t.Errorf("coordinates must be written as [longitude, latitude]: %s", buf.String())
+	}
+
+	collection, err := ReadFeatureCollection(&buf, 10)
+	if err != nil {
+		t.Fatalf("ReadFeatureCollection: %v", err)
+	}
+	position, err := collection.Features[0].Position()
+	if err != nil || !slices.Equal(position, []float64{55.7558, 37.6173}) {
+		t.Errorf("Position() = %v, %v; want [55.7558 37.6173]", position, err)
+	}
+	if got := collection.Features[0].StringID(); got != "b1" {
+		t.Errorf("StringID() = %q", got)
+	}
+	if got := collection.Features[0].StringProperty("label"); got != "Корпус 1" {
+		t.Errorf("label = %q", got)
+	}
+}
+
+func TestReadFeatureCollectionErrors(t *testing.T) {
+	if _, err := ReadFeatureCollection(strings.NewReader(`{"type":"Feature"}`), 10); err != ErrNotFeatureCollection {
+		t.Errorf("error = %v; want ErrNotFeatureCollection", err)
+	}
+	if _, err := ReadFeatureCollection(strings.NewReader(`{"type":"FeatureCollection","features":[{},{}]}`), 1); err == nil {
+		t.Error("expected error for too many features")
+	}
+
+	collection, err := ReadFeatureCollection(strings.NewReader(`{"type":"FeatureCollection","features":[
+		{"type":"Feature","id":12,"geometry":{"type":"LineString","coordinates":[[0,0],[1,1]]}},
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[37.6]}}
+	]}`), 10)
+	if err != nil {
+		t.Fatalf("ReadFeatureCollection: %v", err)
+	}
+	if _, err := collection.Features[0].Position(); err != ErrNotPoint {
+		t.Errorf("LineString: error = %v; want ErrNotPoint", err)
+	}
+	if got := collection.Features[0].StringID(); got != "12" {
+		t.Errorf("numeric id = %q; want \"12\"", got)
+	}
+	if _, err := collection.Features[1].Position(); err == nil {
+		t.Error("expected error for a point with one coordinate")
+	}
+}
@@ -0,0 +1,159 @@
+// Package formats читает и пишет файлы для импорта и экспорта: CSV, XLSX, vCard и GeoJSON
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported file format: expected .csv or .xlsx")
+	ErrEmptyTable        = errors.New("file has no header row")
+)
+
+// Table — первая строка файла как заголовок и остальные строки как данные
+type Table struct {
+	Header []string
+	Rows   [][]string
+	// Номер первой строки данных в исходном файле, для сообщений об ошибках
+	FirstRow int
+}
+
+// DetectFormat определяет формат по расширению имени файла
+func DetectFormat(filename string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// ReadTable читает CSV или XLSX (первый лист) целиком; maxRows ограничивает число строк данных
+func ReadTable(filename string, r io.Reader, maxRows int) (*Table, error) {
+	format, err := DetectFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	switch format {
+	case FormatCSV:
+		records, err = readCSV(r)
+	case FormatXLSX:
+		records, err = readXLSX(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Пустые строки в конце листа Excel не считаются данными
+	for len(records) > 0 && isBlank(records[len(records)-1]) {
+		records = records[:len(records)-1]
+	}
+	if len(records) == 0 {
+		return nil, ErrEmptyTable
+	}
+	if len(records)-1 > maxRows {
+		return nil, fmt.Errorf("file has %d rows, at most %d are allowed", len(records)-1, maxRows)
+	}
+
+	table := &Table{Rows: records[1:], FirstRow: 2}
+	for _, column := range records[0] {
+		table.Header = append(table.Header, strings.TrimSpace(column))
+	}
+	return table, nil
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	br := bufio.NewReader(r)
+	// Excel сохраняет CSV с BOM
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	// В русской локали Excel разделяет поля точкой с запятой
+	head, _ := br.Peek(4096)
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	if bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csv: %w", err)
+	}
+	return records, nil
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xlsx: %w", err)
+	}
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+	if sheet == "" {
+		return nil, ErrEmptyTable
+	}
+
+	rows, err := file.GetRows(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xlsx sheet %q: %w", sheet, err)
+	}
+	return rows, nil
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Column ищет столбец по одному из имён без учёта регистра, пробелов и подчёркиваний; -1 — столбца нет
+func (t *Table) Column(names ...string) int {
+	for i, header := range t.Header {
+		for _, name := range names {
+			if normalizeColumn(header) == normalizeColumn(name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name))
+}
+
+// Cell возвращает значение столбца column в строке row или пустую строку, если столбца нет
+func Cell(row []string, column int) string {
+	if column < 0 || column >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[column])
+}
@@ -0,0 +1,71 @@
+package formats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadTableCSV(t *testing.T) {
+	data := "\xEF\xBB\xBFlogin;full_name;Phone Number\nivanov;Иванов Иван;+79991234567\n;;\n"
+	table, err := ReadTable("users.CSV", strings.NewReader(data), 10)
+	if err != nil {
+		t.Fatalf("ReadTable: %v", err)
+	}
+
+	if len(table.Rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(table.Rows))
+	}
+	if got := Cell(table.Rows[0], table.Column("fullName")); got != "Иванов Иван" {
+		t.Errorf("fullName = %q", got)
+	}
+	if got := Cell(table.Rows[0], table.Column("phoneNumber")); got != "+79991234567" {
+		t.Errorf("phoneNumber = %q", got)
+	}
+	if table.Column("login") != 0 || table.Column("building") != -1 {
+		t.Errorf("unexpected column lookup for header %v", table.Header)
+	}
+}
+
+func TestReadTableXLSX(t *testing.T) {
+	file := excelize.NewFile()
+	file.SetSheetRow("Sheet1", "A1", &[]any{"login", "role"})
+	file.SetSheetRow("Sheet1", "A2", &[]any{"petrov", "STAROSTA"})
+	var buf bytes.Buffer
+	if err := file.Write(&buf); err != nil {
+		t.Fatalf("write xlsx: %v", err)
+	}
+
+	table, err := ReadTable("users.xlsx", &buf, 10)
+	if err != nil {
+		t.Fatalf("ReadTable: %v", err)
+	}
+	if len(table.Rows) != 1 || Cell(table.Rows[0], table.Column("role")) != "STAROSTA" {
+		t.Errorf("unexpected rows %v", table.Rows)
+	}
+}
+
+func TestReadTableLimits(t *testing.T) {
+	if _, err := ReadTable("users.txt", strings.NewReader("login\n"), 10); err != ErrUnsupportedFormat {
+		t.Errorf("txt: err = %v, want ErrUnsupportedFormat", err)
+	}
+	if _, err := ReadTable("users.csv", strings.NewReader("login\na\nb\n"), 1); err == nil {
+		t.Error("expected row limit error")
+	}
+}
+
+func TestWriteVCards(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteVCards(&buf, []VCard{{FullName: "Иванов; Иван", Organization: "Корпус 1, 2", Phone: "+79991234567", TelegramTag: "@ivanov"}})
+	if err != nil {
+		t.Fatalf("WriteVCards: %v", err)
+	}
+
+	want := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Иванов\\; Иван\r\nN:Иванов\\; Иван;;;;\r\nORG:Корпус 1\\, 2\r\n" +
+		"TEL;TYPE=CELL:+79991234567\r\nURL:https://t.me/ivanov\r\nEND:VCARD\r\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,46 @@
+package formats
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// VCard — контакт в формате vCard 3.0; пустые поля не выводятся
+type VCard struct {
+	FullName     string
+	Organization string
+	Title        string
+	Phone        string
+	TelegramTag  string
+}
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+
+// WriteVCards пишет все контакты в один .vcf, который импортируется в телефон целиком
+func WriteVCards(w io.Writer, cards []VCard) error {
+	var b strings.Builder
+	for _, card := range cards {
+		b.WriteString("BEGIN:VCARD\r\nVERSION:3.0\r\n")
+		fmt.Fprintf(&b, "FN:%s\r\n", vCardEscaper.Replace(card.FullName))
+		fmt.Fprintf(&b, "N:%s;;;;\r\n", vCardEscaper.Replace(card.FullName))
+		if card.Organization != "" {
+			fmt.Fprintf(&b, "ORG:%s\r\n", vCardEscaper.Replace(card.Organization))
+		}
+		if card.Title != "" {
+			fmt.Fprintf(&b, "TITLE:%s\r\n", vCardEscaper.Replace(card.Title))
+		}
+		if card.Phone != "" {
+			fmt.Fprintf(&b, "TEL;TYPE=CELL:%s\r\n", vCardEscaper.Replace(card.Phone))
+		}
+		if username := strings.TrimPrefix(card.TelegramTag, "@"); username != "" {
+			fmt.Fprintf(&b, "URL:https://t.me/%s\r\n", vCardEscaper.Replace(username))
+		}
+		b.WriteString("END:VCARD\r\n")
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write vcard: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package formats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// WriteCSV пишет таблицу с BOM, чтобы Excel правильно определил UTF-8
+func WriteCSV(w io.Writer, header []string, rows [][]string) error {
+	if _, err := w.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
+
+func WriteXLSX(w io.Writer, sheet string, header []string, rows [][]string) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	if err := file.SetSheetName(file.GetSheetName(0), sheet); err != nil {
+		return fmt.Errorf("failed to write xlsx: %w", err)
+	}
+
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("failed to write xlsx: %w", err)
+	}
+	for i, record := range append([][]string{header}, rows...) {
+		cells := make([]any, len(record))
+		for j, value := range record {
+			cells[j] = value
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := stream.SetRow(cell, cells); err != nil {
+			return fmt.Errorf("failed to write xlsx: %w", err)
+		}
+	}
+	if err := stream.Flush(); err != nil {
+		return fmt.Errorf("failed to write xlsx: %w", err)
+	}
+
+	if err := file.Write(w); err != nil {
+		return fmt.Errorf("failed to write xlsx: %w", err)
+	}
+	return nil
+}
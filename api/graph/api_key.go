@@ -0,0 +1,37 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+)
+
+// APIKeyScopeGuard пропускает запросы по API-ключу только к корневым полям с директивой @scope,
+// scope которой выдан ключу. Пользователей с токеном не затрагивает.
+func APIKeyScopeGuard(ctx context.Context, next graphql.RootResolver) graphql.Marshaler {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return next(ctx)
+	}
+
+	field := graphql.GetRootFieldContext(ctx).Field
+	if field.Name == "__typename" {
+		return next(ctx)
+	}
+
+	var scope models.APIKeyScope
+	if field.Definition != nil {
+		if d := field.Definition.Directives.ForName("scope"); d != nil {
+			if arg := d.Arguments.ForName("scope"); arg != nil {
+				scope = models.APIKeyScope(arg.Value.Raw)
+			}
+		}
+	}
+
+	if err := middleware.CheckAPIKeyScope(userClaims, field.Name, scope); err != nil {
+		return rejectRootField(ctx, field, err)
+	}
+	return next(ctx)
+}
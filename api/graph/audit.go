@@ -0,0 +1,63 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// auditSnapshot превращает объект в map по json-тегам, поэтому пароли, секреты TOTP
+// и прочие поля с json:"-" в журнал не попадают
+func auditSnapshot(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("auditSnapshot: Failed to encode %T: %v", v, err)
+		return nil
+	}
+
+	var snapshot map[string]any
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		log.Printf("auditSnapshot: Failed to decode %T: %v", v, err)
+		return nil
+	}
+	return snapshot
+}
+
+// audit записывает успешно выполненное привилегированное действие от имени текущего пользователя.
+// Ошибка записи не отменяет действие, которое уже произошло, поэтому только логируется.
+func (r *Resolver) audit(ctx context.Context, action models.AuditAction, summary string, targetIDs []primitive.ObjectID, before, after any) {
+	entry := middleware.NewAuditEntry(ctx, action, summary, targetIDs)
+	entry.Before = auditSnapshot(before)
+	entry.After = auditSnapshot(after)
+
+	if err := r.AuditService.Record(ctx, entry); err != nil {
+		log.Printf("audit: CRITICAL - Failed to record %s by %s: %v", action, entry.ActorLogin, err)
+	}
+}
+
+// placementSnapshot — положение пользователя в корпусах до и после изменения
+func placementSnapshot(user *models.User) map[string]any {
+	if user == nil {
+		return nil
+	}
+	return map[string]any{
+		"login":    user.Login,
+		"fullName": user.FullName,
+		"role":     user.Role,
+		"building": user.Building,
+		"markers":  user.Markers,
+	}
+}
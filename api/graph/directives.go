@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// NewDirectiveRoot связывает директивы @auth, @hasRole и @minRole из schema.graphqls с их реализацией
+func NewDirectiveRoot() DirectiveRoot {
+	return DirectiveRoot{
+		Auth:    authDirective,
+		HasRole: hasRoleDirective,
+		MinRole: minRoleDirective,
+	}
+}
+
+func authDirective(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	userClaims, _ := middleware.GetUserFromContext(ctx)
+	if err := checkAuth(userClaims); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+func hasRoleDirective(ctx context.Context, obj any, next graphql.Resolver, roles []models.UserRole) (any, error) {
+	userClaims, _ := middleware.GetUserFromContext(ctx)
+	if err := checkHasRole(userClaims, roles, fieldPath(ctx)); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+func minRoleDirective(ctx context.Context, obj any, next graphql.Resolver, role models.UserRole) (any, error) {
+	userClaims, _ := middleware.GetUserFromContext(ctx)
+	if err := checkMinRole(userClaims, role, fieldPath(ctx)); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// ObjectDirectives применяет @auth, @hasRole и @minRole, объявленные на типе, к каждому его полю:
+// gqlgen сам вызывает только директивы полей
+func ObjectDirectives(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Field.ObjectDefinition == nil || fc.Field.Name == "__typename" {
+		return next(ctx)
+	}
+
+	userClaims, _ := middleware.GetUserFromContext(ctx)
+	if err := checkObjectDirectives(userClaims, fc.Field.ObjectDefinition.Directives, fc.Path().String()); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+func checkObjectDirectives(userClaims *auth.JWTClaims, directives ast.DirectiveList, path string) error {
+	for _, d := range directives {
+		var err error
+		switch d.Name {
+		case "auth":
+			err = checkAuth(userClaims)
+		case "hasRole":
+			var roles []models.UserRole
+			if arg := d.Arguments.ForName("roles"); arg != nil {
+				for _, child := range arg.Value.Children {
+					roles = append(roles, models.UserRole(child.Value.Raw))
+				}
+			}
+			err = checkHasRole(userClaims, roles, path)
+		case "minRole":
+			var role models.UserRole
+			if arg := d.Arguments.ForName("role"); arg != nil {
+				role = models.UserRole(arg.Value.Raw)
+			}
+			err = checkMinRole(userClaims, role, path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkAuth(userClaims *auth.JWTClaims) error {
+	if userClaims == nil {
+		return fmt.Errorf("unauthorized")
+	}
+	return nil
+}
+
+func checkHasRole(userClaims *auth.JWTClaims, roles []models.UserRole, path string) error {
+	if userClaims == nil {
+		return fmt.Errorf("unauthorized")
+	}
+
+	for _, role := range roles {
+		if userClaims.Role == role {
+			return nil
+		}
+	}
+
+	log.Printf("hasRole: User %s (role %s) denied access to %s", userClaims.UserID, userClaims.Role, path)
+	return fmt.Errorf("access denied: insufficient permissions")
+}
+
+func checkMinRole(userClaims *auth.JWTClaims, role models.UserRole, path string) error {
+	if userClaims == nil {
+		return fmt.Errorf("unauthorized")
+	}
+
+	if !userClaims.Role.IsAtLeast(role) {
+		log.Printf("minRole: User %s (role %s) denied access to %s, requires %s", userClaims.UserID, userClaims.Role, path, role)
+		return fmt.Errorf("access denied: insufficient permissions")
+	}
+
+	return nil
+}
+
+func fieldPath(ctx context.Context) string {
+	if fc := graphql.GetFieldContext(ctx); fc != nil {
+		return fc.Path().String()
+	}
+	return "unknown field"
+}
@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const objectDirectivesSchema = `
+enum UserRole { PREDSEDATEL DGIS STAROSTA SUPERVISOR }
+directive @auth on FIELD_DEFINITION | OBJECT
+directive @hasRole(roles: [UserRole!]!) on FIELD_DEFINITION | OBJECT
+directive @minRole(role: UserRole!) on FIELD_DEFINITION | OBJECT
+
+type Session @auth { id: String! }
+type Report @minRole(role: DGIS) { total: Int! }
+type Contact @hasRole(roles: [STAROSTA, SUPERVISOR]) { phone: String! }
+type Query { session: Session report: Report contact: Contact }
+`
+
+func TestCheckObjectDirectives(t *testing.T) {
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "test.graphqls", Input: objectDirectivesSchema})
+	if err != nil {
+		t.Fatalf("load schema: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		object  string
+		role    models.UserRole
+		anon    bool
+		wantErr bool
+	}{
+		{"auth rejects anonymous", "Session", "", true, true},
+		{"auth allows any role", "Session", models.UserRoleSupervisor, false, false},
+		{"minRole rejects lower role", "Report", models.UserRoleStarosta, false, true},
+		{"minRole allows the role", "Report", models.UserRoleDgis, false, false},
+		{"minRole allows higher role", "Report", models.UserRolePredsedatel, false, false},
+		{"minRole rejects anonymous", "Report", "", true, true},
+		{"hasRole allows listed role", "Contact", models.UserRoleSupervisor, false, false},
+		{"hasRole rejects unlisted role", "Contact", models.UserRolePredsedatel, false, true},
+		{"no directives", "Query", "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userClaims *auth.JWTClaims
+			if !tt.anon {
+				userClaims = &auth.JWTClaims{UserID: "u1", Role: tt.role}
+			}
+			err := checkObjectDirectives(userClaims, schema.Types[tt.object].Directives, tt.object)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+)
+
+func loginLockedError(until time.Time) error {
+	return fmt.Errorf("too many failed login attempts, try again in %s", time.Until(until).Round(time.Second))
+}
+
+// checkLoginAllowed проверяет блокировки по логину и IP до обращения к паролю
+func (r *Resolver) checkLoginAllowed(ctx context.Context, login string) error {
+	lockedUntil, err := r.LoginThrottle.LockedUntil(login, middleware.GetClientIPFromContext(ctx))
+	if err != nil {
+		log.Printf("checkLoginAllowed: Failed to check lockout for login %s: %v", login, err)
+		return fmt.Errorf("login is temporarily unavailable")
+	}
+	if lockedUntil != nil {
+		return loginLockedError(*lockedUntil)
+	}
+	return nil
+}
+
+// registerLoginFailure учитывает неудачную попытку; user равен nil, если логин не найден
+func (r *Resolver) registerLoginFailure(ctx context.Context, login string, user *models.User) {
+	ip := middleware.GetClientIPFromContext(ctx)
+
+	failure, err := r.LoginThrottle.RegisterFailure(login, ip)
+	if err != nil {
+		log.Printf("registerLoginFailure: Failed to register failure for login %s from %s: %v", login, ip, err)
+		return
+	}
+
+	if user == nil || failure.LoginLocked == nil {
+		return
+	}
+
+	if err := r.UserService.SetLockedUntil(ctx, user.ID, failure.LoginLocked); err != nil {
+		log.Printf("registerLoginFailure: Failed to persist lockout for user %s: %v", user.ID.Hex(), err)
+	}
+
+	// Уведомляем владельца только при первой блокировке в окне, а не на каждую следующую попытку
+	if failure.LoginFailures != r.LoginThrottle.MaxAttemptsPerLogin() {
+		return
+	}
+
+	message := fmt.Sprintf(
+		"Зафиксировано %d неудачных попыток входа в ваш аккаунт (последняя с IP %s). Вход заблокирован до %s. Если это были не вы, сообщите администратору.",
+		failure.LoginFailures, ip, failure.LoginLocked.Format("02.01.2006 15:04"),
+	)
+	if err := r.NotificationService.SendSystemNotification(ctx, user.ID, "Подозрительные попытки входа", message); err != nil {
+		log.Printf("registerLoginFailure: Failed to notify user %s about failed logins: %v", user.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,317 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/DGISsoft/DGISback/api/formats"
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxImportFeatures = 1000
+
+// markersGeoJSON собирает FeatureCollection; пользователи в маркерах уже без деактивированных и удалённых
+func markersGeoJSON(markers []*models.Marker) (map[string]any, error) {
+	features := make([]formats.Feature, 0, len(markers))
+	for _, marker := range markers {
+		byRole := map[string]int{}
+		for _, user := range marker.Users {
+			byRole[string(user.Role)]++
+		}
+		features = append(features, formats.NewPointFeature(marker.MarkerID, marker.Position, map[string]any{
+			"markerId":            marker.MarkerID,
+			"label":               marker.Label,
+			"assignedUsers":       len(marker.Users),
+			"assignedUsersByRole": byRole,
+		}))
+	}
+
+	// Map отдаётся клиенту как JSON-объект, поэтому коллекция переводится в map через JSON
+	data, err := json.Marshal(formats.NewFeatureCollection(features))
+	if err != nil {
+		return nil, err
+	}
+	var collection map[string]any
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+type importFeature struct {
+	item     *model.MarkerImportItem
+	existing *models.Marker
+	marker   *models.Marker
+}
+
+func (f *importFeature) fail(err error) {
+	f.item.Errors = append(f.item.Errors, err.Error())
+}
+
+// parseImportFeature проверяет точку по тем же правилам, что и createMarker.
+// markerId берётся из properties.markerId, а если его нет — из id объекта.
+func parseImportFeature(number int, feature formats.Feature) *importFeature {
+	parsed := &importFeature{
+		item:   &model.MarkerImportItem{Feature: &number, Changes: []string{}, Errors: []string{}},
+		marker: &models.Marker{},
+	}
+
+	rawMarkerID := feature.StringProperty("markerId")
+	if rawMarkerID == "" {
+		rawMarkerID = feature.StringID()
+	}
+	var err error
+	if parsed.marker.MarkerID, err = models.NormalizeMarkerID(rawMarkerID); err != nil {
+		parsed.fail(err)
+	} else {
+		parsed.item.MarkerID = &parsed.marker.MarkerID
+	}
+	if parsed.marker.Label, err = models.NormalizeMarkerLabel(feature.StringProperty("label")); err != nil {
+		parsed.fail(err)
+	}
+	if parsed.marker.Position, err = feature.Position(); err != nil {
+		parsed.fail(err)
+	} else if err := models.ValidatePosition(parsed.marker.Position); err != nil {
+		parsed.fail(err)
+	}
+
+	return parsed
+}
+
+// planMarkerImport сопоставляет объекты файла с маркерами в базе и проставляет статусы.
+// Возвращает маркеры, которые в режиме REPLACE будут удалены.
+func planMarkerImport(features []*importFeature, existing []*models.Marker, mode model.MarkerImportMode) []*importFeature {
+	byMarkerID := make(map[string]*models.Marker, len(existing))
+	byLabel := make(map[string]*models.Marker, len(existing))
+	for _, marker := range existing {
+		byMarkerID[marker.MarkerID] = marker
+		byLabel[marker.Label] = marker
+	}
+
+	firstMarkerID := map[string]int{}
+	firstLabel := map[string]int{}
+	inFile := map[string]bool{}
+	for _, feature := range features {
+		marker := feature.marker
+		if marker.MarkerID != "" {
+			inFile[marker.MarkerID] = true
+			if first, seen := firstMarkerID[marker.MarkerID]; seen {
+				feature.fail(fmt.Errorf("duplicate markerId '%s', first used in feature %d", marker.MarkerID, first))
+			} else {
+				firstMarkerID[marker.MarkerID] = *feature.item.Feature
+			}
+		}
+		if marker.Label != "" {
+			if first, seen := firstLabel[marker.Label]; seen {
+				feature.fail(fmt.Errorf("duplicate label '%s', first used in feature %d", marker.Label, first))
+			} else {
+				firstLabel[marker.Label] = *feature.item.Feature
+			}
+		}
+	}
+
+	for _, feature := range features {
+		marker := feature.marker
+		feature.existing = byMarkerID[marker.MarkerID]
+
+		// Подпись занята маркером, который останется в базе: сначала его нужно переименовать
+		if owner, ok := byLabel[marker.Label]; ok && owner.MarkerID != marker.MarkerID &&
+			(mode == model.MarkerImportModeUpsert || inFile[owner.MarkerID]) {
+			feature.fail(fmt.Errorf("label '%s' is already used by marker '%s'", marker.Label, owner.MarkerID))
+		}
+
+		switch {
+		case len(feature.item.Errors) > 0:
+			feature.item.Status = model.MarkerImportStatusInvalid
+		case feature.existing == nil:
+			feature.item.Status = model.MarkerImportStatusCreated
+		default:
+			feature.item.Changes = markerChanges(feature.existing, marker)
+			feature.item.Status = model.MarkerImportStatusUpdated
+			if len(feature.item.Changes) == 0 {
+				feature.item.Status = model.MarkerImportStatusUnchanged
+				feature.item.Marker = feature.existing
+			}
+		}
+	}
+
+	var deleted []*importFeature
+	if mode == model.MarkerImportModeReplace {
+		for _, marker := range existing {
+			if inFile[marker.MarkerID] {
+				continue
+			}
+			markerID := marker.MarkerID
+			deleted = append(deleted, &importFeature{
+				item: &model.MarkerImportItem{
+					MarkerID: &markerID,
+					Status:   model.MarkerImportStatusDeleted,
+					Changes:  []string{},
+					Errors:   []string{},
+					Marker:   marker,
+				},
+				existing: marker,
+			})
+		}
+	}
+	return deleted
+}
+
+func markerChanges(before, after *models.Marker) []string {
+	changes := []string{}
+	if before.Label != after.Label {
+		changes = append(changes, fmt.Sprintf("label: %s -> %s", before.Label, after.Label))
+	}
+	if !slices.Equal(before.Position, after.Position) {
+		changes = append(changes, fmt.Sprintf("position: %v -> %v", before.Position, after.Position))
+	}
+	return changes
+}
+
+// importMarkers проверяет весь файл и, если это не dryRun и ошибок нет, применяет изменения одной транзакцией:
+// сначала удаления (чтобы освободить подписи), затем обновления и создание.
+// Если хоть одно изменение не применилось, откатывается весь импорт.
+func (r *Resolver) importMarkers(ctx context.Context, collection *formats.FeatureCollection, mode model.MarkerImportMode, dryRun bool) (*model.MarkerImportReport, error) {
+	existing, err := r.MarkerService.GetAllMarkers(ctx)
+	if err != nil {
+		log.Printf("importMarkers: Failed to load markers: %v", err)
+		return nil, fmt.Errorf("could not validate import")
+	}
+
+	features := make([]*importFeature, 0, len(collection.Features))
+	for i, feature := range collection.Features {
+		features = append(features, parseImportFeature(i+1, feature))
+	}
+	deleted := planMarkerImport(features, existing, mode)
+	all := append(deleted, features...)
+
+	report := &model.MarkerImportReport{DryRun: dryRun, Mode: mode, Total: len(features), Items: make([]*model.MarkerImportItem, 0, len(all))}
+	var pending []*importFeature
+	for _, feature := range all {
+		switch feature.item.Status {
+		case model.MarkerImportStatusInvalid:
+			report.Invalid++
+		case model.MarkerImportStatusCreated, model.MarkerImportStatusUpdated, model.MarkerImportStatusDeleted:
+			pending = append(pending, feature)
+		}
+	}
+
+	var changedIDs []primitive.ObjectID
+	if !dryRun && len(pending) > 0 {
+		if report.Invalid > 0 {
+			for _, feature := range pending {
+				feature.item.Status = model.MarkerImportStatusSkipped
+			}
+		} else if changedIDs, err = r.applyMarkerImports(ctx, pending); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, feature := range all {
+		item := feature.item
+		switch item.Status {
+		case model.MarkerImportStatusCreated:
+			report.Created++
+		case model.MarkerImportStatusUpdated:
+			report.Updated++
+		case model.MarkerImportStatusDeleted:
+			report.Deleted++
+		case model.MarkerImportStatusUnchanged:
+			report.Unchanged++
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	if len(changedIDs) > 0 {
+		r.audit(ctx, models.AuditActionMarkerImport,
+			fmt.Sprintf("импорт GeoJSON (%s): создано %d, обновлено %d, удалено %d", mode, report.Created, report.Updated, report.Deleted),
+			changedIDs, nil, map[string]any{"mode": mode, "created": report.Created, "updated": report.Updated, "deleted": report.Deleted, "total": report.Total})
+	}
+	return report, nil
+}
+
+// applyMarkerImports применяет изменения в одной транзакции. Если изменение отклонено из-за конфликта,
+// оно помечается FAILED, остальные — SKIPPED, и отчёт возвращается без ошибки.
+func (r *Resolver) applyMarkerImports(ctx context.Context, pending []*importFeature) ([]primitive.ObjectID, error) {
+	var (
+		results []importResult
+		failed  *importFeature
+	)
+	err := r.MarkerService.WithTransaction(ctx, func(ctx context.Context) error {
+		// Транзакция может повторяться, поэтому результаты собираются заново
+		results = make([]importResult, 0, len(pending))
+		failed = nil
+		for _, feature := range pending {
+			result, err := r.applyMarkerImport(ctx, feature)
+			if err != nil {
+				failed = feature
+				return err
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		if failed == nil {
+			log.Printf("importMarkers: Failed to commit import: %v", err)
+			return nil, fmt.Errorf("failed to apply import")
+		}
+		log.Printf("importMarkers: Failed to apply %s for marker '%s': %v", failed.item.Status, failed.marker.MarkerID, err)
+		for _, feature := range pending {
+			feature.item.Status = model.MarkerImportStatusSkipped
+		}
+		failed.item.Status = model.MarkerImportStatusFailed
+		if errors.Is(err, mongo.ErrMarkerConflict) {
+			failed.item.Errors = append(failed.item.Errors, err.Error())
+		} else {
+			failed.item.Errors = append(failed.item.Errors, "failed to apply change")
+		}
+		return nil, nil
+	}
+
+	changedIDs := make([]primitive.ObjectID, 0, len(results))
+	for i, result := range results {
+		item := pending[i].item
+		item.Marker = result.marker
+		item.Changes = append(item.Changes, result.changes...)
+		changedIDs = append(changedIDs, result.marker.ID)
+	}
+	return changedIDs, nil
+}
+
+type importResult struct {
+	marker  *models.Marker
+	changes []string
+}
+
+func (r *Resolver) applyMarkerImport(ctx context.Context, feature *importFeature) (importResult, error) {
+	switch feature.item.Status {
+	case model.MarkerImportStatusDeleted:
+		detached, err := r.MarkerService.DeleteMarker(ctx, feature.existing.ID)
+		if err != nil {
+			return importResult{}, err
+		}
+		return importResult{marker: feature.existing, changes: []string{fmt.Sprintf("снято пользователей: %d", detached)}}, nil
+	case model.MarkerImportStatusUpdated:
+		updated, err := r.MarkerService.UpdateMarker(ctx, feature.existing.ID, mongo.MarkerUpdate{
+			Label:    &feature.marker.Label,
+			Position: feature.marker.Position,
+		})
+		if err != nil {
+			return importResult{}, err
+		}
+		return importResult{marker: updated}, nil
+	default:
+		if err := r.MarkerService.CreateMarker(ctx, feature.marker); err != nil {
+			return importResult{}, err
+		}
+		return importResult{marker: feature.marker}, nil
+	}
+}
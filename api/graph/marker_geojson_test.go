@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/DGISsoft/DGISback/api/formats"
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+)
+
+func importFeatures(points ...map[string]any) []*importFeature {
+	features := make([]*importFeature, 0, len(points))
+	for i, properties := range points {
+		feature := formats.NewPointFeature("", []float64{55.75, 37.61}, properties)
+		features = append(features, parseImportFeature(i+1, feature))
+	}
+	return features
+}
+
+func TestPlanMarkerImportUpsert(t *testing.T) {
+	existing := []*models.Marker{
+		{MarkerID: "b1", Label: "Корпус 1", Position: []float64{55.75, 37.61}},
+		{MarkerID: "b2", Label: "Корпус 2", Position: []float64{55.75, 37.61}},
+		{MarkerID: "b3", Label: "Корпус 3", Position: []float64{55.75, 37.61}},
+	}
+	features := importFeatures(
+		map[string]any{"markerId": "b1", "label": "Корпус 1"},
+		map[string]any{"markerId": "b2", "label": "Корпус 2А"},
+		map[string]any{"markerId": "b4", "label": "Корпус 4"},
+		map[string]any{"markerId": "b5", "label": "Корпус 3"},
+		map[string]any{"markerId": "b4", "label": "Корпус 5"},
+		map[string]any{"markerId": "b6"},
+	)
+
+	deleted := planMarkerImport(features, existing, model.MarkerImportModeUpsert)
+	if len(deleted) != 0 {
+		t.Errorf("UPSERT must not delete markers, got %d", len(deleted))
+	}
+
+	want := []model.MarkerImportStatus{
+		model.MarkerImportStatusUnchanged,
+		model.MarkerImportStatusUpdated,
+		model.MarkerImportStatusCreated,
+		// Подпись занята маркером b3, который останется в базе
+		model.MarkerImportStatusInvalid,
+		// markerId b4 уже встречался в файле
+		model.MarkerImportStatusInvalid,
+		// Нет подписи
+		model.MarkerImportStatusInvalid,
+	}
+	for i, feature := range features {
+		if feature.item.Status != want[i] {
+			t.Errorf("feature %d: status = %s, want %s (errors %v)", i+1, feature.item.Status, want[i], feature.item.Errors)
+		}
+	}
+	if changes := features[1].item.Changes; len(changes) != 1 || changes[0] != "label: Корпус 2 -> Корпус 2А" {
+		t.Errorf("changes = %v", changes)
+	}
+	if features[0].item.Marker != existing[0] {
+		t.Errorf("unchanged feature must reference the existing marker")
+	}
+}
+
+func TestPlanMarkerImportReplace(t *testing.T) {
+	existing := []*models.Marker{
+		{MarkerID: "b1", Label: "Корпус 1", Position: []float64{55.75, 37.61}},
+		{MarkerID: "b2", Label: "Корпус 2", Position: []float64{55.75, 37.61}},
+	}
+	// В режиме REPLACE подпись удаляемого маркера b2 можно занять
+	features := importFeatures(
+		map[string]any{"markerId": "b1", "label": "Корпус 1"},
+		map[string]any{"markerId": "b3", "label": "Корпус 2"},
+	)
+
+	deleted := planMarkerImport(features, existing, model.MarkerImportModeReplace)
+	if len(deleted) != 1 || *deleted[0].item.MarkerID != "b2" || deleted[0].item.Status != model.MarkerImportStatusDeleted {
+		t.Fatalf("deleted = %+v, want marker b2", deleted)
+	}
+	if deleted[0].item.Feature != nil {
+		t.Errorf("deleted marker must not reference a feature")
+	}
+	if status := features[1].item.Status; status != model.MarkerImportStatusCreated {
+		t.Errorf("feature 2: status = %s, want CREATED (errors %v)", status, features[1].item.Errors)
+	}
+}
+
+func TestPlanMarkerImportLabelOfRenamedMarker(t *testing.T) {
+	existing := []*models.Marker{
+		{MarkerID: "b1", Label: "Корпус 1", Position: []float64{55.75, 37.61}},
+		{MarkerID: "b2", Label: "Корпус 2", Position: []float64{55.75, 37.61}},
+	}
+	// b2 в файле переименовывается, но подпись нельзя занять в одном импорте: обновления идут по порядку
+	features := importFeatures(
+		map[string]any{"markerId": "b1", "label": "Корпус 2"},
+		map[string]any{"markerId": "b2", "label": "Корпус 3"},
+	)
+
+	planMarkerImport(features, existing, model.MarkerImportModeReplace)
+	if status := features[0].item.Status; status != model.MarkerImportStatusInvalid {
+		t.Errorf("feature 1: status = %s, want INVALID", status)
+	}
+	if status := features[1].item.Status; status != model.MarkerImportStatusUpdated {
+		t.Errorf("feature 2: status = %s, want UPDATED", status)
+	}
+}
@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
+)
+
+// markerUpdate проверяет и нормализует заданные поля UpdateMarkerInput
+func markerUpdate(input model.UpdateMarkerInput) (mongo.MarkerUpdate, error) {
+	var update mongo.MarkerUpdate
+	if input.MarkerID != nil {
+		markerID, err := models.NormalizeMarkerID(*input.MarkerID)
+		if err != nil {
+			return update, err
+		}
+		update.MarkerID = &markerID
+	}
+	if input.Label != nil {
+		label, err := models.NormalizeMarkerLabel(*input.Label)
+		if err != nil {
+			return update, err
+		}
+		update.Label = &label
+	}
+	if input.Position != nil {
+		if err := models.ValidatePosition(input.Position); err != nil {
+			return update, err
+		}
+		update.Position = input.Position
+	}
+	return update, nil
+}
+
+// markerSnapshot — поля маркера для журнала аудита, без списка пользователей
+func markerSnapshot(marker *models.Marker) map[string]any {
+	if marker == nil {
+		return nil
+	}
+	return map[string]any{
+		"markerId": marker.MarkerID,
+		"label":    marker.Label,
+		"position": marker.Position,
+	}
+}
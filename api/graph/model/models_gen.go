@@ -3,18 +3,49 @@
 package model
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
 	"github.com/DGISsoft/DGISback/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type AcceptInviteInput struct {
+	Token    string `json:"token"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
 type AssignUserInput struct {
 	UserID   primitive.ObjectID `json:"userId"`
 	MarkerID primitive.ObjectID `json:"markerId"`
 }
 
+type AuditLogFilter struct {
+	ActorID *primitive.ObjectID `json:"actorId,omitempty"`
+	// Пользователь, маркер или другой объект, затронутый действием
+	TargetID *primitive.ObjectID `json:"targetId,omitempty"`
+	Actions  []string            `json:"actions,omitempty"`
+	From     *time.Time          `json:"from,omitempty"`
+	To       *time.Time          `json:"to,omitempty"`
+}
+
+type AuditLogPage struct {
+	Entries []*models.AuditEntry `json:"entries"`
+	// Передайте в cursor, чтобы получить следующую страницу; null — записей больше нет
+	NextCursor *string `json:"nextCursor,omitempty"`
+}
+
+// При включённой 2FA login возвращает только challengeToken; токен и пользователь
+// выдаются после verifyTwoFactor
 type AuthPayload struct {
-	Token string       `json:"token"`
-	User  *models.User `json:"user"`
+	Token             *string      `json:"token,omitempty"`
+	User              *models.User `json:"user,omitempty"`
+	TwoFactorRequired bool         `json:"twoFactorRequired"`
+	ChallengeToken    *string      `json:"challengeToken,omitempty"`
 }
 
 type CreateMarkerInput struct {
@@ -33,11 +64,82 @@ type CreateUserInput struct {
 	TelegramTag string          `json:"telegramTag"`
 }
 
+type CreatedAPIKey struct {
+	// Открытое значение ключа, показывается один раз
+	Key    string         `json:"key"`
+	APIKey *models.APIKey `json:"apiKey"`
+}
+
+type DeleteUserResult struct {
+	UserID primitive.ObjectID `json:"userId"`
+	// false — пользователь только помечен удалённым и может быть восстановлен до очистки
+	Permanent       bool `json:"permanent"`
+	MarkersDetached int  `json:"markersDetached"`
+	InboxRemoved    int  `json:"inboxRemoved"`
+	// Уведомления, из которых убраны ссылки на пользователя как отправителя или получателя
+	NotificationsAnonymized int `json:"notificationsAnonymized"`
+}
+
+type InvitePayload struct {
+	Invite *models.Invite `json:"invite"`
+	// Подписанный одноразовый токен; показывается один раз
+	Token string `json:"token"`
+	// Ссылка для приглашённого, если задан INVITE_URL_BASE
+	URL *string `json:"url,omitempty"`
+}
+
+type InviteUserInput struct {
+	Role        models.UserRole `json:"role"`
+	FullName    string          `json:"fullName"`
+	Building    *string         `json:"building,omitempty"`
+	PhoneNumber string          `json:"phoneNumber"`
+	TelegramTag string          `json:"telegramTag"`
+}
+
+type LinkIssue struct {
+	Kind             LinkIssueKind      `json:"kind"`
+	MarkerID         primitive.ObjectID `json:"markerId"`
+	UserID           primitive.ObjectID `json:"userId"`
+	Building         *string            `json:"building,omitempty"`
+	ExpectedBuilding *string            `json:"expectedBuilding,omitempty"`
+	// Исправление, которое применит linkcheck --fix, в виде строки диффа
+	Fix string `json:"fix"`
+}
+
+type LinkReport struct {
+	MarkersScanned int          `json:"markersScanned"`
+	UsersScanned   int          `json:"usersScanned"`
+	Issues         []*LinkIssue `json:"issues"`
+}
+
 type LoginInput struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 }
 
+type MarkerImportItem struct {
+	// Номер объекта в features, начиная с 1; null для маркеров, удаляемых в режиме REPLACE
+	Feature  *int               `json:"feature,omitempty"`
+	MarkerID *string            `json:"markerId,omitempty"`
+	Status   MarkerImportStatus `json:"status"`
+	// Изменённые поля в виде «поле: было -> стало»
+	Changes []string       `json:"changes"`
+	Errors  []string       `json:"errors"`
+	Marker  *models.Marker `json:"marker,omitempty"`
+}
+
+type MarkerImportReport struct {
+	DryRun    bool                `json:"dryRun"`
+	Mode      MarkerImportMode    `json:"mode"`
+	Total     int                 `json:"total"`
+	Created   int                 `json:"created"`
+	Updated   int                 `json:"updated"`
+	Deleted   int                 `json:"deleted"`
+	Unchanged int                 `json:"unchanged"`
+	Invalid   int                 `json:"invalid"`
+	Items     []*MarkerImportItem `json:"items"`
+}
+
 type Mutation struct {
 }
 
@@ -47,6 +149,11 @@ type NotificationSender struct {
 	Building *string            `json:"building,omitempty"`
 }
 
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
+}
+
 type Query struct {
 }
 
@@ -64,3 +171,454 @@ type SendNotificationInput struct {
 
 type Subscription struct {
 }
+
+// Данные Telegram Login Widget без изменений, включая hash
+type TelegramLoginInput struct {
+	ID        string  `json:"id"`
+	FirstName *string `json:"firstName,omitempty"`
+	LastName  *string `json:"lastName,omitempty"`
+	Username  *string `json:"username,omitempty"`
+	PhotoURL  *string `json:"photoUrl,omitempty"`
+	AuthDate  int     `json:"authDate"`
+	Hash      string  `json:"hash"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// Незаданные поля не меняются
+type UpdateMarkerInput struct {
+	MarkerID *string `json:"markerId,omitempty"`
+	// [широта, долгота]
+	Position []float64 `json:"position,omitempty"`
+	// Новая подпись записывается и в building пользователей корпуса
+	Label *string `json:"label,omitempty"`
+}
+
+type UpdateMyProfileInput struct {
+	FullName    *string `json:"fullName,omitempty"`
+	PhoneNumber *string `json:"phoneNumber,omitempty"`
+	// Тег не должен быть указан у другого пользователя; при смене тега привязка к Telegram снимается
+	TelegramTag *string `json:"telegramTag,omitempty"`
+}
+
+// Пустые поля не меняются; пустая строка в building снимает корпус
+type UpdateUserInput struct {
+	FullName    *string          `json:"fullName,omitempty"`
+	Role        *models.UserRole `json:"role,omitempty"`
+	Building    *string          `json:"building,omitempty"`
+	PhoneNumber *string          `json:"phoneNumber,omitempty"`
+	// Тег не должен быть указан у другого пользователя; при смене тега привязка к Telegram снимается
+	TelegramTag *string `json:"telegramTag,omitempty"`
+}
+
+type UserConnection struct {
+	Edges    []*UserEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+	// Число пользователей, подходящих под фильтр, без учёта пагинации
+	TotalCount int `json:"totalCount"`
+}
+
+type UserEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *models.User `json:"node"`
+}
+
+type UserImportReport struct {
+	DryRun  bool             `json:"dryRun"`
+	Total   int              `json:"total"`
+	Created int              `json:"created"`
+	Invalid int              `json:"invalid"`
+	Rows    []*UserImportRow `json:"rows"`
+}
+
+type UserImportRow struct {
+	// Номер строки в файле, считая заголовок первой строкой
+	Row    int                 `json:"row"`
+	Login  *string             `json:"login,omitempty"`
+	Status UserImportRowStatus `json:"status"`
+	Errors []string            `json:"errors"`
+	User   *models.User        `json:"user,omitempty"`
+}
+
+type UserOrder struct {
+	Field     UserOrderField `json:"field"`
+	Direction OrderDirection `json:"direction"`
+}
+
+type UsersFilter struct {
+	Roles []models.UserRole `json:"roles,omitempty"`
+	// По умолчанию удалённые пользователи не показываются
+	Statuses []models.UserStatus `json:"statuses,omitempty"`
+	Building *string             `json:"building,omitempty"`
+	MarkerID *primitive.ObjectID `json:"markerId,omitempty"`
+	// Подстрока ФИО или логина
+	Search *string `json:"search,omitempty"`
+}
+
+type LinkIssueKind string
+
+const (
+	// Маркер ссылается на пользователя, а пользователь на маркер — нет
+	LinkIssueKindMarkerOnlyLink LinkIssueKind = "MARKER_ONLY_LINK"
+	// Пользователь ссылается на маркер, а маркер на пользователя — нет
+	LinkIssueKindUserOnlyLink     LinkIssueKind = "USER_ONLY_LINK"
+	LinkIssueKindDanglingUserID   LinkIssueKind = "DANGLING_USER_ID"
+	LinkIssueKindDanglingMarkerID LinkIssueKind = "DANGLING_MARKER_ID"
+	// building не совпадает с подписью ни одного маркера пользователя
+	LinkIssueKindBuildingMismatch LinkIssueKind = "BUILDING_MISMATCH"
+)
+
+var AllLinkIssueKind = []LinkIssueKind{
+	LinkIssueKindMarkerOnlyLink,
+	LinkIssueKindUserOnlyLink,
+	LinkIssueKindDanglingUserID,
+	LinkIssueKindDanglingMarkerID,
+	LinkIssueKindBuildingMismatch,
+}
+
+func (e LinkIssueKind) IsValid() bool {
+	switch e {
+	case LinkIssueKindMarkerOnlyLink, LinkIssueKindUserOnlyLink, LinkIssueKindDanglingUserID, LinkIssueKindDanglingMarkerID, LinkIssueKindBuildingMismatch:
+		return true
+	}
+	return false
+}
+
+func (e LinkIssueKind) String() string {
+	return string(e)
+}
+
+func (e *LinkIssueKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LinkIssueKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LinkIssueKind", str)
+	}
+	return nil
+}
+
+func (e LinkIssueKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *LinkIssueKind) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e LinkIssueKind) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type MarkerImportMode string
+
+const (
+	// Создать новые маркеры и обновить совпавшие по markerId; остальные не трогать
+	MarkerImportModeUpsert MarkerImportMode = "UPSERT"
+	// Как UPSERT, но маркеры, которых нет в файле, удаляются вместе с назначениями
+	MarkerImportModeReplace MarkerImportMode = "REPLACE"
+)
+
+var AllMarkerImportMode = []MarkerImportMode{
+	MarkerImportModeUpsert,
+	MarkerImportModeReplace,
+}
+
+func (e MarkerImportMode) IsValid() bool {
+	switch e {
+	case MarkerImportModeUpsert, MarkerImportModeReplace:
+		return true
+	}
+	return false
+}
+
+func (e MarkerImportMode) String() string {
+	return string(e)
+}
+
+func (e *MarkerImportMode) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MarkerImportMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MarkerImportMode", str)
+	}
+	return nil
+}
+
+func (e MarkerImportMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *MarkerImportMode) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e MarkerImportMode) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// При dryRun статус описывает изменение, которое было бы сделано
+type MarkerImportStatus string
+
+const (
+	MarkerImportStatusCreated   MarkerImportStatus = "CREATED"
+	MarkerImportStatusUpdated   MarkerImportStatus = "UPDATED"
+	MarkerImportStatusUnchanged MarkerImportStatus = "UNCHANGED"
+	MarkerImportStatusDeleted   MarkerImportStatus = "DELETED"
+	MarkerImportStatusInvalid   MarkerImportStatus = "INVALID"
+	// Объект корректен, но не применён: в файле есть ошибки или импорт откатился
+	MarkerImportStatusSkipped MarkerImportStatus = "SKIPPED"
+	// Объект корректен, но применить изменение не удалось; весь импорт откатывается
+	MarkerImportStatusFailed MarkerImportStatus = "FAILED"
+)
+
+var AllMarkerImportStatus = []MarkerImportStatus{
+	MarkerImportStatusCreated,
+	MarkerImportStatusUpdated,
+	MarkerImportStatusUnchanged,
+	MarkerImportStatusDeleted,
+	MarkerImportStatusInvalid,
+	MarkerImportStatusSkipped,
+	MarkerImportStatusFailed,
+}
+
+func (e MarkerImportStatus) IsValid() bool {
+	switch e {
+	case MarkerImportStatusCreated, MarkerImportStatusUpdated, MarkerImportStatusUnchanged, MarkerImportStatusDeleted, MarkerImportStatusInvalid, MarkerImportStatusSkipped, MarkerImportStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e MarkerImportStatus) String() string {
+	return string(e)
+}
+
+func (e *MarkerImportStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MarkerImportStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MarkerImportStatus", str)
+	}
+	return nil
+}
+
+func (e MarkerImportStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *MarkerImportStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e MarkerImportStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type OrderDirection string
+
+const (
+	OrderDirectionAsc  OrderDirection = "ASC"
+	OrderDirectionDesc OrderDirection = "DESC"
+)
+
+var AllOrderDirection = []OrderDirection{
+	OrderDirectionAsc,
+	OrderDirectionDesc,
+}
+
+func (e OrderDirection) IsValid() bool {
+	switch e {
+	case OrderDirectionAsc, OrderDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e OrderDirection) String() string {
+	return string(e)
+}
+
+func (e *OrderDirection) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderDirection", str)
+	}
+	return nil
+}
+
+func (e OrderDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *OrderDirection) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e OrderDirection) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type UserImportRowStatus string
+
+const (
+	// Строка прошла проверку (dryRun)
+	UserImportRowStatusValid   UserImportRowStatus = "VALID"
+	UserImportRowStatusInvalid UserImportRowStatus = "INVALID"
+	UserImportRowStatusCreated UserImportRowStatus = "CREATED"
+	// Строка корректна, но не создана: частичный импорт не запрошен, а в файле есть ошибки или импорт откатился
+	UserImportRowStatusSkipped UserImportRowStatus = "SKIPPED"
+	// Строка корректна, но создать пользователя не удалось; без partial откатывается весь импорт
+	UserImportRowStatusFailed UserImportRowStatus = "FAILED"
+)
+
+var AllUserImportRowStatus = []UserImportRowStatus{
+	UserImportRowStatusValid,
+	UserImportRowStatusInvalid,
+	UserImportRowStatusCreated,
+	UserImportRowStatusSkipped,
+	UserImportRowStatusFailed,
+}
+
+func (e UserImportRowStatus) IsValid() bool {
+	switch e {
+	case UserImportRowStatusValid, UserImportRowStatusInvalid, UserImportRowStatusCreated, UserImportRowStatusSkipped, UserImportRowStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e UserImportRowStatus) String() string {
+	return string(e)
+}
+
+func (e *UserImportRowStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserImportRowStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserImportRowStatus", str)
+	}
+	return nil
+}
+
+func (e UserImportRowStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *UserImportRowStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e UserImportRowStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type UserOrderField string
+
+const (
+	UserOrderFieldFullName  UserOrderField = "FULL_NAME"
+	UserOrderFieldLogin     UserOrderField = "LOGIN"
+	UserOrderFieldCreatedAt UserOrderField = "CREATED_AT"
+)
+
+var AllUserOrderField = []UserOrderField{
+	UserOrderFieldFullName,
+	UserOrderFieldLogin,
+	UserOrderFieldCreatedAt,
+}
+
+func (e UserOrderField) IsValid() bool {
+	switch e {
+	case UserOrderFieldFullName, UserOrderFieldLogin, UserOrderFieldCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e UserOrderField) String() string {
+	return string(e)
+}
+
+func (e *UserOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserOrderField", str)
+	}
+	return nil
+}
+
+func (e UserOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *UserOrderField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e UserOrderField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
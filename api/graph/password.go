@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// PasswordChangeGuard не пускает пользователя с флагом mustChangePassword дальше смены пароля
+func PasswordChangeGuard(ctx context.Context, next graphql.RootResolver) graphql.Marshaler {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return next(ctx)
+	}
+
+	field := graphql.GetRootFieldContext(ctx).Field
+	if err := middleware.CheckPasswordChange(userClaims, field.Name); err != nil {
+		return rejectRootField(ctx, field, err)
+	}
+	return next(ctx)
+}
+
+// rejectRootField отвечает на корневое поле ошибкой доступа с кодом в extensions
+func rejectRootField(ctx context.Context, field graphql.CollectedField, err *middleware.AccessError) graphql.Marshaler {
+	graphql.AddError(ctx, &gqlerror.Error{
+		Message:    err.Message,
+		Path:       ast.Path{ast.PathName(field.Alias)},
+		Extensions: map[string]any{"code": err.Code},
+	})
+	return graphql.Null
+}
@@ -1,6 +1,10 @@
 package graph
 
-import "github.com/DGISsoft/DGISback/services/mongo"
+import (
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/services/mongo"
+	"github.com/DGISsoft/DGISback/services/redis"
+)
 
 // This file will not be regenerated automatically.
 //
@@ -9,4 +13,15 @@ type Resolver struct{
 	UserService *mongo.UserService
 	MarkerService *mongo.MarkerService
 	NotificationService *mongo.NotificationService
+	APIKeyService *mongo.APIKeyService
+	InviteService *mongo.InviteService
+	AuditService *mongo.AuditService
+	UserCascade mongo.UserCascadeStore
+	SessionService *redis.SessionService
+	LoginThrottle *redis.LoginThrottle
+	TwoFactorService *redis.TwoFactorService
+	PasswordPolicy *auth.PasswordPolicy
+	TwoFactorPolicy *auth.TwoFactorPolicy
+	TelegramVerifier *auth.TelegramVerifier
+	JWTManager *auth.JWTManager
 }
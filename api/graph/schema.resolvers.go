@@ -6,184 +6,1361 @@ package graph
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/api/formats"
 	"github.com/DGISsoft/DGISback/api/graph/model"
 	"github.com/DGISsoft/DGISback/middleware"
 	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
 	"github.com/DGISsoft/DGISback/services/mongo/query"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Owner is the resolver for the owner field.
+func (r *apiKeyResolver) Owner(ctx context.Context, obj *models.APIKey) (*models.User, error) {
+	owner, err := r.UserService.GetUserByID(ctx, obj.OwnerID)
+	if err != nil {
+		log.Printf("ApiKey.owner: Failed to get owner %s of api key %s: %v", obj.OwnerID.Hex(), obj.ID.Hex(), err)
+		return nil, fmt.Errorf("could not retrieve api key owner")
+	}
+	return owner, nil
+}
+
+// Actor is the resolver for the actor field.
+func (r *auditEntryResolver) Actor(ctx context.Context, obj *models.AuditEntry) (*models.User, error) {
+	if obj.ActorID.IsZero() {
+		return nil, nil
+	}
+	actor, err := r.UserService.GetUserByID(ctx, obj.ActorID)
+	if err != nil {
+		// Автор записи мог быть удалён; actorLogin сохраняется в самой записи
+		return nil, nil
+	}
+	return actor, nil
+}
+
+// Action is the resolver for the action field.
+func (r *auditEntryResolver) Action(ctx context.Context, obj *models.AuditEntry) (string, error) {
+	return string(obj.Action), nil
+}
+
+// User is the resolver for the user field.
+func (r *inviteResolver) User(ctx context.Context, obj *models.Invite) (*models.User, error) {
+	user, err := r.UserService.GetUserByID(ctx, obj.UserID)
+	if err != nil {
+		log.Printf("Invite.user: Failed to get user %s of invite %s: %v", obj.UserID.Hex(), obj.ID.Hex(), err)
+		return nil, fmt.Errorf("could not retrieve invited user")
+	}
+	return user, nil
+}
+
+// InvitedBy is the resolver for the invitedBy field.
+func (r *inviteResolver) InvitedBy(ctx context.Context, obj *models.Invite) (*models.User, error) {
+	user, err := r.UserService.GetUserByID(ctx, obj.CreatedBy)
+	if err != nil {
+		// Пригласивший мог быть удалён
+		return nil, nil
+	}
+	return user, nil
+}
+
+// Expired is the resolver for the expired field.
+func (r *inviteResolver) Expired(ctx context.Context, obj *models.Invite) (bool, error) {
+	return !obj.ExpiresAt.After(time.Now()), nil
+}
+
 // Login is the resolver for the login field.
 func (r *mutationResolver) Login(ctx context.Context, input model.LoginInput) (*model.AuthPayload, error) {
+	if err := r.checkLoginAllowed(ctx, input.Login); err != nil {
+		log.Printf("Login: Rejected attempt for login %s: %v", input.Login, err)
+		return nil, err
+	}
+
 	user, err := r.UserService.GetUserByLogin(ctx, input.Login)
 	if err != nil {
 		log.Printf("Login: Authentication failed for login %s: %v", input.Login, err)
+		r.registerLoginFailure(ctx, input.Login, nil)
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	if !user.IsActive() {
+		log.Printf("Login: User %s is not active (status %s)", input.Login, user.Status)
+		r.registerLoginFailure(ctx, input.Login, nil)
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
+	if user.IsLocked() {
+		log.Printf("Login: User %s is locked until %s", input.Login, user.LockedUntil)
+		return nil, loginLockedError(*user.LockedUntil)
+	}
+
 	if !r.UserService.CheckPassword(user.Password, input.Password) {
 		log.Printf("Login: Invalid password provided for user %s", input.Login)
+		r.registerLoginFailure(ctx, input.Login, user)
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	jwtManager := auth.NewJWTManager(auth.GetSecretKey(), auth.GetTokenDuration())
-	tokenString, err := jwtManager.GenerateToken(user)
+	if err := r.LoginThrottle.Reset(input.Login); err != nil {
+		log.Printf("Login: Failed to reset failed attempts for user %s: %v", input.Login, err)
+	}
+	if user.LockedUntil != nil {
+		if err := r.UserService.SetLockedUntil(ctx, user.ID, nil); err != nil {
+			log.Printf("Login: Failed to clear expired lockout for user %s: %v", input.Login, err)
+		}
+		user.LockedUntil = nil
+	}
+
+	return r.completeLogin(ctx, user)
+}
+
+// LoginWithTelegram is the resolver for the loginWithTelegram field.
+func (r *mutationResolver) LoginWithTelegram(ctx context.Context, input model.TelegramLoginInput) (*model.AuthPayload, error) {
+	data := telegramLoginData(input)
+	throttleKey := telegramThrottleKey(data.ID)
+
+	if err := r.checkLoginAllowed(ctx, throttleKey); err != nil {
+		log.Printf("LoginWithTelegram: Rejected attempt for telegram ID %s: %v", data.ID, err)
+		return nil, err
+	}
+
+	if err := r.TelegramVerifier.Verify(data); err != nil {
+		log.Printf("LoginWithTelegram: Verification failed for telegram ID %s: %v", data.ID, err)
+		if errors.Is(err, auth.ErrTelegramNotConfigured) {
+			return nil, err
+		}
+		r.registerLoginFailure(ctx, throttleKey, nil)
+		return nil, fmt.Errorf("invalid telegram login data")
+	}
+
+	user, err := r.UserService.GetUserByTelegramID(ctx, data.ID)
+	if err != nil {
+		log.Printf("LoginWithTelegram: Telegram ID %s is not linked to any user", data.ID)
+		return nil, fmt.Errorf("telegram account is not linked; log in with your password and link it in your profile")
+	}
+
+	if !user.IsActive() {
+		log.Printf("LoginWithTelegram: User %s is not active (status %s)", user.Login, user.Status)
+		return nil, fmt.Errorf("telegram account is not linked to any user")
+	}
+
+	if user.IsLocked() {
+		log.Printf("LoginWithTelegram: User %s is locked until %s", user.Login, user.LockedUntil)
+		return nil, loginLockedError(*user.LockedUntil)
+	}
+
+	if err := r.LoginThrottle.Reset(throttleKey); err != nil {
+		log.Printf("LoginWithTelegram: Failed to reset failed attempts for telegram ID %s: %v", data.ID, err)
+	}
+
+	log.Printf("LoginWithTelegram: Telegram ID %s authenticated as user %s", data.ID, user.Login)
+	return r.completeLogin(ctx, user)
+}
+
+// VerifyTwoFactor is the resolver for the verifyTwoFactor field.
+func (r *mutationResolver) VerifyTwoFactor(ctx context.Context, challengeToken string, code string) (*model.AuthPayload, error) {
+	userIDHex, err := r.TwoFactorService.GetChallenge(challengeToken)
+	if err != nil {
+		log.Printf("VerifyTwoFactor: Invalid challenge: %v", err)
+		return nil, fmt.Errorf("login challenge is invalid or expired, please log in again")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid challenge data")
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("VerifyTwoFactor: Failed to get user %s: %v", userIDHex, err)
+		return nil, fmt.Errorf("user account unavailable")
+	}
+
+	// Пока код вводился, пользователя могли деактивировать или удалить
+	if !user.IsActive() {
+		log.Printf("VerifyTwoFactor: User %s is not active (status %s)", user.Login, user.Status)
+		if err := r.TwoFactorService.DeleteChallenge(challengeToken); err != nil {
+			log.Printf("VerifyTwoFactor: Failed to delete challenge for user %s: %v", user.Login, err)
+		}
+		return nil, fmt.Errorf("user account unavailable")
+	}
+
+	if err := r.checkLoginAllowed(ctx, user.Login); err != nil {
+		return nil, err
+	}
+	if user.IsLocked() {
+		return nil, loginLockedError(*user.LockedUntil)
+	}
+
+	ok, err := r.verifySecondFactor(ctx, user, code)
+	if err != nil {
+		log.Printf("VerifyTwoFactor: Failed to verify code for user %s: %v", user.Login, err)
+		return nil, fmt.Errorf("login is temporarily unavailable")
+	}
+	if !ok {
+		log.Printf("VerifyTwoFactor: Invalid code for user %s", user.Login)
+		if err := r.TwoFactorService.RegisterChallengeFailure(challengeToken, loginChallengeTTL); err != nil {
+			log.Printf("VerifyTwoFactor: Failed to register challenge failure: %v", err)
+		}
+		r.registerLoginFailure(ctx, user.Login, user)
+		return nil, fmt.Errorf("invalid two-factor code")
+	}
+
+	if err := r.TwoFactorService.DeleteChallenge(challengeToken); err != nil {
+		log.Printf("VerifyTwoFactor: Failed to delete challenge for user %s: %v", user.Login, err)
+	}
+	if err := r.LoginThrottle.Reset(user.Login); err != nil {
+		log.Printf("VerifyTwoFactor: Failed to reset failed attempts for user %s: %v", user.Login, err)
+	}
+
+	tokenString, err := r.issueSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("VerifyTwoFactor: User %s logged in with second factor", user.Login)
+	return &model.AuthPayload{
+		Token: &tokenString,
+		User:  user,
+	}, nil
+}
+
+// RefreshToken is the resolver for the refreshToken field.
+func (r *mutationResolver) RefreshToken(ctx context.Context) (*model.AuthPayload, error) {
+	refreshToken := middleware.GetRefreshTokenFromContext(ctx)
+	if refreshToken == "" {
+		return nil, fmt.Errorf("unauthorized: refresh token is missing")
+	}
+
+	session, err := r.SessionService.RotateRefreshToken(refreshToken)
+	if err != nil {
+		log.Printf("RefreshToken: Failed to rotate refresh token: %v", err)
+		if writer, werr := middleware.GetResponseWriterFromContext(ctx); werr == nil {
+			middleware.SignalClearAuthCookieDirect(writer)
+		}
+		return nil, fmt.Errorf("unauthorized: refresh token is invalid")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session data")
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("RefreshToken: Failed to get user %s for session %s: %v", session.UserID, session.ID, err)
+		return nil, fmt.Errorf("user account unavailable")
+	}
+	if !user.IsActive() {
+		log.Printf("RefreshToken: User %s is %s, refusing to refresh session %s", session.UserID, user.Status, session.ID)
+		return nil, fmt.Errorf("user account unavailable")
+	}
+
+	tokenString, err := r.issueTokens(ctx, user, session)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return &model.AuthPayload{
+		Token: &tokenString,
+		User:  user,
+	}, nil
+}
+
+// Logout is the resolver for the logout field.
+func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
+	if userClaims, isAuthenticated := middleware.GetUserFromContext(ctx); isAuthenticated {
+		if err := r.SessionService.RevokeSession(userClaims.SessionID()); err != nil {
+			log.Printf("Logout: Failed to revoke session %s of user %s: %v", userClaims.SessionID(), userClaims.UserID, err)
+		}
+	}
+
+	writer, err := middleware.GetResponseWriterFromContext(ctx)
+	if err != nil {
+		log.Printf("Logout: Could not get ResponseWriter from context: %v", err)
+	} else {
+		middleware.SignalClearAuthCookieDirect(writer)
+	}
+
+	return true, nil
+}
+
+// LogoutAllSessions is the resolver for the logoutAllSessions field.
+func (r *mutationResolver) LogoutAllSessions(ctx context.Context) (bool, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return false, fmt.Errorf("unauthorized")
+	}
+
+	revoked, err := r.SessionService.RevokeUserSessions(userClaims.UserID, "")
+	if err != nil {
+		log.Printf("LogoutAllSessions: Failed to revoke sessions of user %s: %v", userClaims.UserID, err)
+		return false, fmt.Errorf("could not terminate sessions")
+	}
+
+	writer, err := middleware.GetResponseWriterFromContext(ctx)
+	if err != nil {
+		log.Printf("LogoutAllSessions: Could not get ResponseWriter from context: %v", err)
+	} else {
+		middleware.SignalClearAuthCookieDirect(writer)
+	}
+
+	log.Printf("LogoutAllSessions: User %s terminated %d sessions", userClaims.UserID, revoked)
+	return true, nil
+}
+
+// LinkMyTelegram is the resolver for the linkMyTelegram field.
+func (r *mutationResolver) LinkMyTelegram(ctx context.Context, input model.TelegramLoginInput) (*models.User, error) {
+	user, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := telegramLoginData(input)
+	if err := r.TelegramVerifier.Verify(data); err != nil {
+		log.Printf("LinkMyTelegram: Verification failed for user %s, telegram ID %s: %v", user.Login, data.ID, err)
+		if errors.Is(err, auth.ErrTelegramNotConfigured) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid telegram login data")
+	}
+
+	if err := checkTelegramLink(user, data); err != nil {
+		log.Printf("LinkMyTelegram: Refused to link telegram ID %s (username %q) to user %s: %v", data.ID, data.Username, user.Login, err)
+		return nil, err
+	}
+
+	if err := r.UserService.LinkTelegramID(ctx, user.ID, data.ID); err != nil {
+		log.Printf("LinkMyTelegram: Failed to link telegram ID %s to user %s: %v", data.ID, user.Login, err)
+		if errors.Is(err, mongo.ErrTelegramAlreadyLinked) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not link telegram account")
+	}
+	log.Printf("LinkMyTelegram: Linked telegram ID %s to user %s", data.ID, user.Login)
+
+	message := "К вашему аккаунту привязан Telegram. Если это были не вы, сообщите администратору."
+	if data.Username != "" {
+		message = fmt.Sprintf("К вашему аккаунту привязан Telegram @%s. Если это были не вы, сообщите администратору.", data.Username)
+	}
+	if err := r.NotificationService.SendSystemNotification(ctx, user.ID, "Привязан Telegram", message); err != nil {
+		log.Printf("LinkMyTelegram: Failed to notify user %s about linked telegram: %v", user.ID.Hex(), err)
+	}
+
+	updated, err := r.UserService.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve user information")
+	}
+	return updated, nil
+}
+
+// UnlinkMyTelegram is the resolver for the unlinkMyTelegram field.
+func (r *mutationResolver) UnlinkMyTelegram(ctx context.Context) (bool, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return false, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return false, fmt.Errorf("invalid authentication data")
+	}
+
+	if err := r.UserService.UnlinkTelegramID(ctx, userID); err != nil {
+		log.Printf("UnlinkMyTelegram: Failed to unlink telegram for user %s: %v", userClaims.UserID, err)
+		return false, fmt.Errorf("could not unlink telegram account")
+	}
+
+	log.Printf("UnlinkMyTelegram: User %s unlinked telegram account", userClaims.UserID)
+	return true, nil
+}
+
+// ChangeMyPassword is the resolver for the changeMyPassword field.
+func (r *mutationResolver) ChangeMyPassword(ctx context.Context, currentPassword string, newPassword string) (bool, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return false, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID in token")
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("ChangeMyPassword: Failed to get user %s: %v", userID.Hex(), err)
+		return false, fmt.Errorf("user account unavailable")
+	}
+
+	// Перебор текущего пароля из украденной сессии ограничивается так же, как вход
+	if err := r.checkLoginAllowed(ctx, user.Login); err != nil {
+		return false, err
+	}
+	if !r.UserService.CheckPassword(user.Password, currentPassword) {
+		log.Printf("ChangeMyPassword: Invalid current password for user %s", user.Login)
+		r.registerLoginFailure(ctx, user.Login, user)
+		return false, fmt.Errorf("current password is incorrect")
+	}
+	if err := r.LoginThrottle.Reset(user.Login); err != nil {
+		log.Printf("ChangeMyPassword: Failed to reset failed attempts for user %s: %v", user.Login, err)
+	}
+
+	if currentPassword == newPassword {
+		return false, fmt.Errorf("new password must differ from the current one")
+	}
+
+	if err := r.PasswordPolicy.Validate(newPassword, user.Login, user.TelegramTag, user.PhoneNumber); err != nil {
+		return false, err
+	}
+
+	if err := r.UserService.ChangePassword(ctx, userID, newPassword); err != nil {
+		log.Printf("ChangeMyPassword: Failed to change password for user %s: %v", user.Login, err)
+		return false, fmt.Errorf("could not change password")
+	}
+
+	revoked, err := r.SessionService.RevokeUserSessions(userClaims.UserID, userClaims.SessionID())
+	if err != nil {
+		log.Printf("ChangeMyPassword: Failed to revoke other sessions of user %s: %v", user.Login, err)
+	}
+
+	// Перевыпускаем токены текущей сессии, чтобы снять флаг смены пароля из claims
+	session, err := r.SessionService.GetSession(userClaims.SessionID())
+	if err != nil {
+		log.Printf("ChangeMyPassword: Failed to get current session of user %s: %v", user.Login, err)
+		return false, fmt.Errorf("password changed, please log in again")
+	}
+	user.MustChangePassword = false
+	if _, err := r.issueTokens(ctx, user, session); err != nil {
+		return false, err
+	}
+
+	log.Printf("ChangeMyPassword: User %s changed password, %d other sessions revoked", user.Login, revoked)
+	return true, nil
+}
+
+// ResetUserPassword is the resolver for the resetUserPassword field.
+func (r *mutationResolver) ResetUserPassword(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return "", fmt.Errorf("unauthorized")
+	}
+
+	requesterID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return "", fmt.Errorf("invalid requester ID in token")
+	}
+	if requesterID == userID {
+		return "", fmt.Errorf("use changeMyPassword to change your own password")
+	}
+
+	requester, err := r.UserService.GetUserByID(ctx, requesterID)
+	if err != nil {
+		log.Printf("ResetUserPassword: Failed to get requester %s: %v", requesterID.Hex(), err)
+		return "", fmt.Errorf("failed to get requester info: %w", err)
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("user not found")
+	}
+
+	if !requester.HasHigherRole(user.Role) {
+		log.Printf("ResetUserPassword: User %s (role %s) attempted to reset password of user %s (role %s) - forbidden by role hierarchy",
+			requesterID.Hex(), requester.Role, userID.Hex(), user.Role)
+		return "", fmt.Errorf("insufficient permissions to reset password of user with role %s", user.Role)
+	}
+
+	temporaryPassword, err := r.PasswordPolicy.GenerateTemporaryPassword()
+	if err != nil {
+		log.Printf("ResetUserPassword: Failed to generate temporary password: %v", err)
+		return "", fmt.Errorf("could not reset password")
+	}
+
+	if err := r.UserService.SetTemporaryPassword(ctx, userID, temporaryPassword); err != nil {
+		log.Printf("ResetUserPassword: Failed to set temporary password for user %s: %v", userID.Hex(), err)
+		return "", fmt.Errorf("could not reset password")
+	}
+
+	if _, err := r.SessionService.RevokeUserSessions(userID.Hex(), ""); err != nil {
+		log.Printf("ResetUserPassword: Failed to revoke sessions of user %s: %v", userID.Hex(), err)
+	}
+
+	log.Printf("ResetUserPassword: User %s reset password of user %s", requesterID.Hex(), userID.Hex())
+	r.audit(ctx, models.AuditActionUserPasswordReset, fmt.Sprintf("сброшен пароль пользователя %s", user.Login),
+		[]primitive.ObjectID{userID}, nil, nil)
+	return temporaryPassword, nil
+}
+
+// BeginTwoFactorEnrollment is the resolver for the beginTwoFactorEnrollment field.
+func (r *mutationResolver) BeginTwoFactorEnrollment(ctx context.Context) (*model.TwoFactorEnrollment, error) {
+	user, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("BeginTwoFactorEnrollment: Failed to generate secret for user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("could not start two-factor enrollment")
+	}
+
+	if err := r.UserService.SetPendingTOTPSecret(ctx, user.ID, secret); err != nil {
+		log.Printf("BeginTwoFactorEnrollment: Failed to save secret for user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("could not start two-factor enrollment")
+	}
+
+	return &model.TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(r.TwoFactorPolicy.Issuer, user.Login, secret),
+	}, nil
+}
+
+// ConfirmTwoFactorEnrollment is the resolver for the confirmTwoFactorEnrollment field.
+func (r *mutationResolver) ConfirmTwoFactorEnrollment(ctx context.Context, code string) ([]string, error) {
+	user, userClaims, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	if user.TOTPPendingSecret == "" {
+		return nil, fmt.Errorf("two-factor enrollment was not started")
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPPendingSecret, code, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("invalid two-factor code")
+	}
+	if _, err := r.TwoFactorService.MarkCodeUsed(user.ID.Hex(), step, usedTOTPCodeTTL); err != nil {
+		log.Printf("ConfirmTwoFactorEnrollment: Failed to mark code as used for user %s: %v", user.ID.Hex(), err)
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		log.Printf("ConfirmTwoFactorEnrollment: Failed to generate recovery codes for user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("could not enable two-factor authentication")
+	}
+
+	if err := r.UserService.EnableTOTP(ctx, user.ID, user.TOTPPendingSecret, hashes); err != nil {
+		log.Printf("ConfirmTwoFactorEnrollment: Failed to enable totp for user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("could not enable two-factor authentication")
+	}
+	log.Printf("ConfirmTwoFactorEnrollment: User %s enabled two-factor authentication", user.ID.Hex())
+
+	// Токен с флагом обязательного подключения больше не нужен — перевыпускаем его для текущей сессии
+	if userClaims.TwoFactorSetupRequired {
+		user.TOTPEnabled = true
+		session, err := r.SessionService.GetSession(userClaims.SessionID())
+		if err != nil {
+			log.Printf("ConfirmTwoFactorEnrollment: Failed to get current session of user %s: %v", user.ID.Hex(), err)
+		} else if _, err := r.issueTokens(ctx, user, session); err != nil {
+			log.Printf("ConfirmTwoFactorEnrollment: Failed to reissue tokens for user %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes is the resolver for the regenerateRecoveryCodes field.
+func (r *mutationResolver) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	user, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := r.verifySecondFactor(ctx, user, code)
+	if err != nil {
+		log.Printf("RegenerateRecoveryCodes: Failed to verify code for user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("could not verify two-factor code")
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid two-factor code")
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		log.Printf("RegenerateRecoveryCodes: Failed to generate recovery codes for user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("could not regenerate recovery codes")
+	}
+
+	if err := r.UserService.SetRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		log.Printf("RegenerateRecoveryCodes: Failed to save recovery codes for user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("could not regenerate recovery codes")
+	}
+
+	log.Printf("RegenerateRecoveryCodes: User %s regenerated recovery codes", user.ID.Hex())
+	return codes, nil
+}
+
+// DisableTwoFactor is the resolver for the disableTwoFactor field.
+func (r *mutationResolver) DisableTwoFactor(ctx context.Context, code string) (bool, error) {
+	user, _, err := r.currentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if r.TwoFactorPolicy.IsRequired(user.Role) {
+		return false, fmt.Errorf("two-factor authentication is mandatory for role %s", user.Role)
+	}
+
+	ok, err := r.verifySecondFactor(ctx, user, code)
+	if err != nil {
+		log.Printf("DisableTwoFactor: Failed to verify code for user %s: %v", user.ID.Hex(), err)
+		return false, fmt.Errorf("could not verify two-factor code")
+	}
+	if !ok {
+		return false, fmt.Errorf("invalid two-factor code")
+	}
+
+	if err := r.UserService.DisableTOTP(ctx, user.ID); err != nil {
+		log.Printf("DisableTwoFactor: Failed to disable totp for user %s: %v", user.ID.Hex(), err)
+		return false, fmt.Errorf("could not disable two-factor authentication")
+	}
+
+	log.Printf("DisableTwoFactor: User %s disabled two-factor authentication", user.ID.Hex())
+	return true, nil
+}
+
+// ResetUserTwoFactor is the resolver for the resetUserTwoFactor field.
+func (r *mutationResolver) ResetUserTwoFactor(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	requester, _, err := r.currentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	if requester.ID == userID {
+		return false, fmt.Errorf("use disableTwoFactor to turn off your own two-factor authentication")
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("user not found")
+	}
+
+	if err := authorizeTwoFactorReset(requester, user); err != nil {
+		log.Printf("ResetUserTwoFactor: User %s (role %s) attempted to reset 2FA of user %s (role %s) - forbidden by role hierarchy",
+			requester.ID.Hex(), requester.Role, userID.Hex(), user.Role)
+		return false, err
+	}
+
+	if err := r.UserService.DisableTOTP(ctx, userID); err != nil {
+		log.Printf("ResetUserTwoFactor: Failed to disable totp for user %s: %v", userID.Hex(), err)
+		return false, fmt.Errorf("could not reset two-factor authentication")
+	}
+
+	// Сессии могли быть открыты с утерянного устройства
+	if _, err := r.SessionService.RevokeUserSessions(userID.Hex(), ""); err != nil {
+		log.Printf("ResetUserTwoFactor: Failed to revoke sessions of user %s: %v", userID.Hex(), err)
+	}
+
+	log.Printf("ResetUserTwoFactor: User %s reset two-factor authentication of user %s", requester.ID.Hex(), userID.Hex())
+	r.audit(ctx, models.AuditActionUserTwoFactorReset, fmt.Sprintf("сброшена 2FA пользователя %s", user.Login),
+		[]primitive.ObjectID{userID}, map[string]any{"twoFactorEnabled": user.TOTPEnabled}, map[string]any{"twoFactorEnabled": false})
+	return true, nil
+}
+
+// RevokeUserSessions is the resolver for the revokeUserSessions field.
+func (r *mutationResolver) RevokeUserSessions(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return 0, fmt.Errorf("unauthorized")
+	}
+
+	requesterID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid requester ID in token")
+	}
+
+	requester, err := r.UserService.GetUserByID(ctx, requesterID)
+	if err != nil {
+		log.Printf("RevokeUserSessions: Failed to get requester %s: %v", requesterID.Hex(), err)
+		return 0, fmt.Errorf("failed to get requester info: %w", err)
+	}
+
+	target, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("user not found")
+	}
+
+	// Как и сброс пароля и 2FA, только для ролей строго ниже своей: равный по роли не может выбить другого администратора
+	if !requester.HasHigherRole(target.Role) {
+		log.Printf("RevokeUserSessions: User %s (role %s) attempted to revoke sessions of user %s (role %s) - forbidden by role hierarchy",
+			requesterID.Hex(), requester.Role, userID.Hex(), target.Role)
+		return 0, fmt.Errorf("insufficient permissions to revoke sessions of user with role %s", target.Role)
+	}
+
+	revoked, err := r.SessionService.RevokeUserSessions(userID.Hex(), "")
+	if err != nil {
+		log.Printf("RevokeUserSessions: Failed to revoke sessions of user %s: %v", userID.Hex(), err)
+		return 0, fmt.Errorf("could not revoke sessions")
+	}
+
+	log.Printf("RevokeUserSessions: User %s revoked %d sessions of user %s", requesterID.Hex(), revoked, userID.Hex())
+	r.audit(ctx, models.AuditActionUserSessionsRevoke,
+		fmt.Sprintf("отозваны сессии пользователя %s (%d)", target.Login, revoked),
+		[]primitive.ObjectID{userID}, nil, map[string]any{"revokedSessions": revoked})
+	return revoked, nil
+}
+
+// UnlockUser is the resolver for the unlockUser field.
+func (r *mutationResolver) UnlockUser(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	requesterID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid requester ID in token")
+	}
+
+	requester, err := r.UserService.GetUserByID(ctx, requesterID)
+	if err != nil {
+		log.Printf("UnlockUser: Failed to get requester %s: %v", requesterID.Hex(), err)
+		return nil, fmt.Errorf("failed to get requester info: %w", err)
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	// Как и сброс пароля и 2FA, только для ролей строго ниже своей
+	if !requester.HasHigherRole(user.Role) {
+		log.Printf("UnlockUser: User %s (role %s) attempted to unlock user %s (role %s) - forbidden by role hierarchy",
+			requesterID.Hex(), requester.Role, id.Hex(), user.Role)
+		return nil, fmt.Errorf("insufficient permissions to unlock user with role %s", user.Role)
+	}
+
+	if err := r.UserService.SetLockedUntil(ctx, id, nil); err != nil {
+		log.Printf("UnlockUser: Failed to unlock user %s: %v", id.Hex(), err)
+		return nil, fmt.Errorf("could not unlock user")
+	}
+	if err := r.LoginThrottle.Reset(user.Login); err != nil {
+		log.Printf("UnlockUser: Failed to reset failed attempts for user %s: %v", user.Login, err)
+	}
+
+	log.Printf("UnlockUser: User %s unlocked user %s", requesterID.Hex(), id.Hex())
+	r.audit(ctx, models.AuditActionUserUnlock, fmt.Sprintf("разблокирован пользователь %s", user.Login),
+		[]primitive.ObjectID{id}, map[string]any{"lockedUntil": user.LockedUntil}, map[string]any{"lockedUntil": nil})
+	user.LockedUntil = nil
+	user.Password = ""
+	return user, nil
+}
+
+// CreateUser is the resolver for the createUser field.
+func (r *mutationResolver) CreateUser(ctx context.Context, input model.CreateUserInput) (*models.User, error) {
+	requester, err := r.authorizeUserCreation(ctx, models.UserRole(input.Role))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("CreateUser: Requested by user ID %s", requester.ID.Hex())
+
+	phoneNumber, err := models.NormalizePhoneNumber(input.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	telegramTag, err := models.NormalizeTelegramTag(input.TelegramTag)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ensureTelegramTagFree(ctx, telegramTag, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	_, err = r.UserService.GetUserByLogin(ctx, input.Login)
+	if err == nil {
+		return nil, fmt.Errorf("user with login '%s' already exists", input.Login)
+	}
+
+	user := &models.User{
+		Login:       input.Login,
+		Password:    input.Password,
+		Role:        models.UserRole(input.Role),
+		FullName:    input.FullName,
+		Building:    input.Building,
+		PhoneNumber: phoneNumber,
+		TelegramTag: telegramTag,
+		Status:      models.UserStatusActive,
+		Markers:     []primitive.ObjectID{},
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	if err := r.PasswordPolicy.Validate(input.Password, input.Login, telegramTag, phoneNumber); err != nil {
+		return nil, err
+	}
+
+	err = r.UserService.CreateUser(ctx, user)
+	if err != nil {
+		log.Printf("CreateUser: Failed to create user in service: %v", err)
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := r.assignUserToBuilding(ctx, user); err != nil {
+		// Иначе createUser сообщил бы об успехе, а пользователь остался бы без маркера своего корпуса
+		if err := r.UserService.DeleteUser(ctx, user.ID); err != nil {
+			log.Printf("CreateUser: Failed to clean up user %s: %v", user.ID.Hex(), err)
+		}
+		return nil, err
+	}
+
+	user.Password = ""
+	r.audit(ctx, models.AuditActionUserCreate, fmt.Sprintf("создан пользователь %s (%s)", user.Login, user.Role),
+		[]primitive.ObjectID{user.ID}, nil, user)
+	return user, nil
+}
+
+// ImportUsers is the resolver for the importUsers field.
+func (r *mutationResolver) ImportUsers(ctx context.Context, file graphql.Upload, dryRun bool, partial bool) (*model.UserImportReport, error) {
+	requester, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("ImportUsers: User %s uploaded %s (%d bytes), dryRun=%t, partial=%t",
+		requester.ID.Hex(), file.Filename, file.Size, dryRun, partial)
+
+	table, err := formats.ReadTable(file.Filename, file.File, maxImportRows)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := r.importUsers(ctx, requester, table, dryRun, partial)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("ImportUsers: %d rows, %d invalid, %d created", report.Total, report.Invalid, report.Created)
+	return report, nil
+}
+
+// InviteUser is the resolver for the inviteUser field.
+func (r *mutationResolver) InviteUser(ctx context.Context, input model.InviteUserInput) (*model.InvitePayload, error) {
+	role := models.UserRole(input.Role)
+	requester, err := r.authorizeUserCreation(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("InviteUser: Requested by user ID %s", requester.ID.Hex())
+
+	phoneNumber, err := models.NormalizePhoneNumber(input.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	telegramTag, err := models.NormalizeTelegramTag(input.TelegramTag)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ensureTelegramTagFree(ctx, telegramTag, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Role:        role,
+		FullName:    input.FullName,
+		Building:    input.Building,
+		PhoneNumber: phoneNumber,
+		TelegramTag: telegramTag,
+		Status:      models.UserStatusPending,
+		Markers:     []primitive.ObjectID{},
+	}
+
+	if err := r.UserService.CreateUser(ctx, user); err != nil {
+		log.Printf("InviteUser: Failed to create pending user: %v", err)
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	invite := &models.Invite{
+		UserID:    user.ID,
+		CreatedBy: requester.ID,
+		ExpiresAt: time.Now().Add(auth.GetInviteDuration()),
+	}
+	if err := r.InviteService.CreateInvite(ctx, invite); err != nil {
+		log.Printf("InviteUser: Failed to create invite for user %s: %v", user.ID.Hex(), err)
+		if err := r.UserService.DeleteUser(ctx, user.ID); err != nil {
+			log.Printf("InviteUser: Failed to clean up pending user %s: %v", user.ID.Hex(), err)
+		}
+		return nil, fmt.Errorf("failed to create invite")
+	}
+
+	token, err := r.JWTManager.GenerateInviteToken(invite.ID.Hex(), invite.ExpiresAt)
+	if err != nil {
+		log.Printf("InviteUser: Failed to sign invite %s: %v", invite.ID.Hex(), err)
+		return nil, fmt.Errorf("failed to create invite")
+	}
+
+	payload := &model.InvitePayload{
+		Invite: invite,
+		Token:  token,
+	}
+	if url := auth.InviteURL(token); url != "" {
+		payload.URL = &url
+	}
+
+	log.Printf("InviteUser: User %s invited pending user %s with role %s", requester.ID.Hex(), user.ID.Hex(), role)
+	r.audit(ctx, models.AuditActionUserInvite, fmt.Sprintf("приглашён пользователь %s (%s)", user.FullName, user.Role),
+		[]primitive.ObjectID{user.ID, invite.ID}, nil, user)
+	return payload, nil
+}
+
+// RevokeInvite is the resolver for the revokeInvite field.
+func (r *mutationResolver) RevokeInvite(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	invite, err := r.InviteService.GetInviteByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, invite.UserID)
+	if err != nil {
+		return false, fmt.Errorf("invited user not found")
+	}
+
+	// Отозвать приглашение может тот, кто мог бы его выдать
+	requester, err := r.authorizeUserCreation(ctx, user.Role)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.InviteService.RevokeInvite(ctx, id); err != nil {
+		log.Printf("RevokeInvite: Failed to revoke invite %s: %v", id.Hex(), err)
+		return false, fmt.Errorf("failed to revoke invite: %w", err)
+	}
+
+	if user.Status == models.UserStatusPending {
+		if err := r.UserService.DeleteUser(ctx, user.ID); err != nil {
+			log.Printf("RevokeInvite: Failed to delete pending user %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	log.Printf("RevokeInvite: User %s revoked invite %s", requester.ID.Hex(), id.Hex())
+	r.audit(ctx, models.AuditActionInviteRevoke, fmt.Sprintf("отозвано приглашение для %s", user.FullName),
+		[]primitive.ObjectID{invite.ID, user.ID}, user, nil)
+	return true, nil
+}
+
+// AcceptInvite is the resolver for the acceptInvite field.
+func (r *mutationResolver) AcceptInvite(ctx context.Context, input model.AcceptInviteInput) (*model.AuthPayload, error) {
+	inviteIDHex, err := r.JWTManager.VerifyInviteToken(input.Token)
+	if err != nil {
+		log.Printf("AcceptInvite: Invalid invite token: %v", err)
+		return nil, auth.ErrInvalidInvite
+	}
+
+	inviteID, err := primitive.ObjectIDFromHex(inviteIDHex)
+	if err != nil {
+		return nil, auth.ErrInvalidInvite
+	}
+
+	invite, err := r.InviteService.GetInviteByID(ctx, inviteID)
+	if err != nil || !invite.IsPending() {
+		return nil, auth.ErrInvalidInvite
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, invite.UserID)
+	if err != nil || user.Status != models.UserStatusPending {
+		return nil, auth.ErrInvalidInvite
+	}
+
+	login := strings.TrimSpace(input.Login)
+	if login == "" {
+		return nil, fmt.Errorf("login is required")
+	}
+	if _, err := r.UserService.GetUserByLogin(ctx, login); err == nil {
+		return nil, fmt.Errorf("user with login '%s' already exists", login)
+	}
+
+	if err := r.PasswordPolicy.Validate(input.Password, login, user.TelegramTag, user.PhoneNumber); err != nil {
+		return nil, err
+	}
+
+	// Активация, принятие приглашения и привязка к маркеру корпуса — одна транзакция: иначе при сбое между ними
+	// приглашение окажется использованным, а пользователь так и останется PENDING или без маркера
+	var inviteErr error
+	err = r.UserService.WithTransaction(ctx, func(ctx context.Context) error {
+		inviteErr = nil
+		if err := r.UserService.ActivateUser(ctx, user.ID, login, input.Password); err != nil {
+			return err
+		}
+		if err := r.InviteService.AcceptInvite(ctx, invite.ID); err != nil {
+			inviteErr = err
+			return err
+		}
+		return r.assignUserToBuilding(ctx, user)
+	})
+	if err != nil {
+		switch {
+		case inviteErr != nil:
+			log.Printf("AcceptInvite: Invite %s could not be accepted: %v", invite.ID.Hex(), err)
+			return nil, auth.ErrInvalidInvite
+		case errors.Is(err, mongo.ErrLoginTaken):
+			return nil, fmt.Errorf("user with login '%s' already exists", login)
+		}
+		log.Printf("AcceptInvite: Failed to activate user %s: %v", user.ID.Hex(), err)
+		return nil, fmt.Errorf("failed to activate account")
+	}
+	user.Login = login
+	user.Status = models.UserStatusActive
+
+	log.Printf("AcceptInvite: User %s accepted invite %s as %s", user.ID.Hex(), invite.ID.Hex(), login)
+	return r.completeLogin(ctx, user)
+}
+
+// UpdateUser is the resolver for the updateUser field.
+func (r *mutationResolver) UpdateUser(ctx context.Context, id primitive.ObjectID, input model.UpdateUserInput) (*models.User, error) {
+	requester, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	if !requester.HasHigherRole(user.Role) {
+		log.Printf("UpdateUser: User %s (role %s) attempted to update user %s (role %s) - forbidden by role hierarchy",
+			requester.ID.Hex(), requester.Role, id.Hex(), user.Role)
+		return nil, fmt.Errorf("insufficient permissions to update user with role %s", user.Role)
+	}
+
+	set, err := profileUpdate(input.FullName, input.PhoneNumber, input.TelegramTag)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkTelegramTag(ctx, user, set); err != nil {
+		return nil, err
+	}
+
+	roleChanged := false
+	if input.Role != nil && models.UserRole(*input.Role) != user.Role {
+		role := models.UserRole(*input.Role)
+		if !role.IsValid() {
+			return nil, fmt.Errorf("invalid user role: %s", role)
+		}
+		if !requester.HasEqualOrHigherRole(role) {
+			log.Printf("UpdateUser: User %s (role %s) attempted to promote user %s to role %s - forbidden by role hierarchy",
+				requester.ID.Hex(), requester.Role, id.Hex(), role)
+			return nil, fmt.Errorf("insufficient permissions to assign role %s", role)
+		}
+		set["role"] = role
+		roleChanged = true
+	}
+
+	buildingChanged := false
+	if input.Building != nil {
+		building := strings.TrimSpace(*input.Building)
+		current := ""
+		if user.Building != nil {
+			current = *user.Building
+		}
+		if building != current {
+			if building == "" {
+				set["building"] = nil
+			} else {
+				set["building"] = building
+			}
+			buildingChanged = true
+		}
+	}
+
+	if len(set) == 0 {
+		user.Password = ""
+		return user, nil
+	}
+
+	// Снимаем с маркера старого корпуса до записи: RemoveUserFromMarker сам перезаписывает building
+	if buildingChanged {
+		r.detachUserFromBuilding(ctx, user)
+	}
+
+	if err := r.UserService.UpdateUser(ctx, id, set); err != nil {
+		log.Printf("UpdateUser: Failed to update user %s: %v", id.Hex(), err)
+		return nil, fmt.Errorf("could not update user")
+	}
+
+	updated, err := r.UserService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve updated user")
+	}
+	if buildingChanged || roleChanged {
+		if err := r.assignUserToBuilding(ctx, updated); err != nil {
+			return nil, err
+		}
+		if updated, err = r.UserService.GetUserByID(ctx, id); err != nil {
+			return nil, fmt.Errorf("could not retrieve updated user")
+		}
+	}
+
+	// Роль записана в access-токене: без отзыва сессий пониженный пользователь сохранил бы права до его истечения
+	if roleChanged {
+		if _, err := r.SessionService.RevokeUserSessions(id.Hex(), ""); err != nil {
+			log.Printf("UpdateUser: Failed to revoke sessions of user %s: %v", id.Hex(), err)
+		}
+	}
+
+	log.Printf("UpdateUser: User %s updated user %s", requester.ID.Hex(), id.Hex())
+	r.audit(ctx, models.AuditActionUserUpdate, fmt.Sprintf("изменён пользователь %s", user.Login),
+		[]primitive.ObjectID{id}, user, updated)
+	updated.Password = ""
+	return updated, nil
+}
+
+// UpdateMyProfile is the resolver for the updateMyProfile field.
+func (r *mutationResolver) UpdateMyProfile(ctx context.Context, input model.UpdateMyProfileInput) (*models.User, error) {
+	user, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := profileUpdate(input.FullName, input.PhoneNumber, input.TelegramTag)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkTelegramTag(ctx, user, set); err != nil {
+		return nil, err
+	}
+
+	if len(set) > 0 {
+		if err := r.UserService.UpdateUser(ctx, user.ID, set); err != nil {
+			log.Printf("UpdateMyProfile: Failed to update user %s: %v", user.ID.Hex(), err)
+			return nil, fmt.Errorf("could not update profile")
+		}
+		if user, err = r.UserService.GetUserByID(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("could not retrieve updated profile")
+		}
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// DeactivateUser is the resolver for the deactivateUser field.
+func (r *mutationResolver) DeactivateUser(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	requester, user, err := r.authorizeLifecycleChange(ctx, id, "deactivate")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.UserService.SetUserStatus(ctx, id, models.UserStatusDeactivated, models.UserStatusActive); err != nil {
+		if errors.Is(err, mongo.ErrUserStatusConflict) {
+			return nil, fmt.Errorf("only active users can be deactivated")
+		}
+		log.Printf("DeactivateUser: Failed to deactivate user %s: %v", id.Hex(), err)
+		return nil, fmt.Errorf("could not deactivate user")
+	}
+	r.revokeUserAccess(ctx, user)
+
+	updated, err := r.UserService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve updated user")
+	}
+
+	log.Printf("DeactivateUser: User %s deactivated user %s", requester.ID.Hex(), id.Hex())
+	r.audit(ctx, models.AuditActionUserDeactivate, fmt.Sprintf("деактивирован пользователь %s", user.Login),
+		[]primitive.ObjectID{id}, map[string]any{"status": user.CurrentStatus()}, map[string]any{"status": updated.Status})
+	updated.Password = ""
+	return updated, nil
+}
+
+// RestoreUser is the resolver for the restoreUser field.
+func (r *mutationResolver) RestoreUser(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	requester, user, err := r.authorizeLifecycleChange(ctx, id, "restore")
 	if err != nil {
-		log.Printf("Login: Failed to generate token for user %s: %v", user.Login, err)
-		return nil, fmt.Errorf("could not generate authentication token")
+		return nil, err
 	}
 
-	authPayload := &model.AuthPayload{
-		Token: tokenString,
-		User:  user,
+	// Удалённый до принятия приглашения пользователь возвращается приглашённым: логина и пароля у него нет
+	status := models.UserStatusActive
+	if user.Login == "" {
+		status = models.UserStatusPending
+	}
+	if err := r.UserService.SetUserStatus(ctx, id, status, models.UserStatusDeactivated, models.UserStatusDeleted); err != nil {
+		if errors.Is(err, mongo.ErrUserStatusConflict) {
+			return nil, fmt.Errorf("only deactivated or deleted users can be restored")
+		}
+		log.Printf("RestoreUser: Failed to restore user %s: %v", id.Hex(), err)
+		return nil, fmt.Errorf("could not restore user")
 	}
 
-	writer, err := middleware.GetResponseWriterFromContext(ctx)
+	updated, err := r.UserService.GetUserByID(ctx, id)
 	if err != nil {
-		log.Printf("Login: CRITICAL - Could not get ResponseWriter from context: %v", err)
-		return nil, fmt.Errorf("internal error (token generated, but could not set cookie)")
+		return nil, fmt.Errorf("could not retrieve updated user")
 	}
 
-	middleware.SignalSetAuthCookieDirect(writer, tokenString)
-
-	return authPayload, nil
+	log.Printf("RestoreUser: User %s restored user %s", requester.ID.Hex(), id.Hex())
+	r.audit(ctx, models.AuditActionUserRestore, fmt.Sprintf("восстановлен пользователь %s", user.Login),
+		[]primitive.ObjectID{id}, map[string]any{"status": user.CurrentStatus()}, map[string]any{"status": updated.Status})
+	updated.Password = ""
+	return updated, nil
 }
 
-// Logout is the resolver for the logout field.
-func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
-	writer, err := middleware.GetResponseWriterFromContext(ctx)
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationResolver) DeleteUser(ctx context.Context, id primitive.ObjectID, permanent bool) (*model.DeleteUserResult, error) {
+	requester, userToDelete, err := r.authorizeLifecycleChange(ctx, id, "delete")
 	if err != nil {
-		log.Printf("Logout: Could not get ResponseWriter from context: %v", err)
-	} else {
-		middleware.SignalClearAuthCookieDirect(writer)
+		return nil, err
 	}
+	log.Printf("DeleteUser: Requested by user ID %s to delete user ID %s (permanent: %t)", requester.ID.Hex(), id.Hex(), permanent)
+
+	if userToDelete.CurrentStatus() != models.UserStatusDeleted {
+		// Документ остаётся до очистки, чтобы история (например, отправитель уведомлений) оставалась доступной
+		err = r.UserService.SetUserStatus(ctx, id, models.UserStatusDeleted,
+			models.UserStatusPending, models.UserStatusActive, models.UserStatusDeactivated)
+		if err != nil {
+			if errors.Is(err, mongo.ErrUserStatusConflict) {
+				return nil, fmt.Errorf("user is already deleted")
+			}
+			log.Printf("DeleteUser: Failed to delete user %s in service: %v", id.Hex(), err)
+			return nil, fmt.Errorf("failed to delete user")
+		}
+		r.revokeUserAccess(ctx, userToDelete)
 
-	return true, nil
-}
-
-// CreateUser is the resolver for the createUser field.
-func (r *mutationResolver) CreateUser(ctx context.Context, input model.CreateUserInput) (*models.User, error) {
-	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
-	if !isAuthenticated {
-		return nil, fmt.Errorf("unauthorized")
+		log.Printf("DeleteUser: Successfully deleted user ID %s", id.Hex())
+		r.audit(ctx, models.AuditActionUserDelete, fmt.Sprintf("удалён пользователь %s (%s)", userToDelete.Login, userToDelete.Role),
+			[]primitive.ObjectID{id}, userToDelete, map[string]any{"status": models.UserStatusDeleted})
+	} else if !permanent {
+		return nil, fmt.Errorf("user is already deleted")
 	}
-	log.Printf("CreateUser: Requested by user ID %s", userClaims.UserID)
 
-	_, err := r.UserService.GetUserByLogin(ctx, input.Login)
-	if err == nil {
-		return nil, fmt.Errorf("user with login '%s' already exists", input.Login)
+	result := &model.DeleteUserResult{UserID: id}
+	if !permanent {
+		return result, nil
 	}
 
-	user := &models.User{
-		Login:       input.Login,
-		Password:    input.Password,
-		Role:        models.UserRole(input.Role),
-		FullName:    input.FullName,
-		Building:    input.Building,
-		PhoneNumber: input.PhoneNumber,
-		TelegramTag: input.TelegramTag,
-		Markers:     []primitive.ObjectID{},
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	cascade, err := r.purgeUser(ctx, userToDelete)
+	if err != nil {
+		log.Printf("DeleteUser: Cleanup of user %s failed: %v", id.Hex(), err)
+		if errors.Is(err, mongo.ErrUserNotDeleted) {
+			return nil, fmt.Errorf("user was restored and cannot be deleted permanently")
+		}
+		return nil, fmt.Errorf("user is marked as deleted, but cleanup failed and will be retried by the next purge")
 	}
 
-	if !user.Role.IsValid() {
-		return nil, fmt.Errorf("invalid user role: %s", input.Role)
-	}
+	result.Permanent = true
+	result.MarkersDetached = int(cascade.MarkersDetached)
+	result.InboxRemoved = int(cascade.InboxRemoved)
+	result.NotificationsAnonymized = int(cascade.NotificationsAnonymized)
+	return result, nil
+}
 
-	err = r.UserService.CreateUser(ctx, user)
+// CreateMarker is the resolver for the createMarker field.
+func (r *mutationResolver) CreateMarker(ctx context.Context, input model.CreateMarkerInput) (*models.Marker, error) {
+	markerID, err := models.NormalizeMarkerID(input.MarkerID)
 	if err != nil {
-		log.Printf("CreateUser: Failed to create user in service: %v", err)
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, err
+	}
+	label, err := models.NormalizeMarkerLabel(input.Label)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.ValidatePosition(input.Position); err != nil {
+		return nil, err
 	}
 
-	if (user.Role == models.UserRoleStarosta || user.Role == models.UserRoleSupervisor || user.Role == models.UserRolePredsedatel) &&
-		user.Building != nil && *user.Building != "" {
-
-		if user.ID.IsZero() {
-			log.Printf("CreateUser: Warning - User ID is zero after creation, skipping auto-assignment for user login '%s'", user.Login)
-		} else {
-			log.Printf("CreateUser: Attempting to auto-assign user %s to marker for building '%s'", user.ID.Hex(), *user.Building)
-
-			marker, err := r.MarkerService.GetMarkerByLabel(ctx, *user.Building)
-			if err != nil {
-				log.Printf("CreateUser: Warning - Could not find marker for building '%s': %v", *user.Building, err)
-			} else {
-				err = r.MarkerService.AssignUserToMarker(ctx, user.ID, marker.ID)
-				if err != nil {
-					log.Printf("CreateUser: Warning - Failed to assign user %s to marker %s: %v", user.ID.Hex(), marker.ID.Hex(), err)
-				} else {
-					log.Printf("CreateUser: Successfully assigned user %s to marker %s for building '%s'", user.ID.Hex(), marker.ID.Hex(), *user.Building)
-				}
-			}
+	marker := &models.Marker{MarkerID: markerID, Label: label, Position: input.Position}
+	if err := r.MarkerService.CreateMarker(ctx, marker); err != nil {
+		if errors.Is(err, mongo.ErrMarkerConflict) {
+			return nil, err
 		}
+		log.Printf("CreateMarker: Failed to create marker '%s': %v", label, err)
+		return nil, fmt.Errorf("failed to create marker")
 	}
 
-	user.Password = ""
-	return user, nil
+	r.audit(ctx, models.AuditActionMarkerCreate,
+		fmt.Sprintf("создан корпус %s (%s)", marker.Label, marker.MarkerID),
+		[]primitive.ObjectID{marker.ID}, nil, markerSnapshot(marker))
+
+	return marker, nil
 }
 
-// DeleteUser is the resolver for the deleteUser field.
-func (r *mutationResolver) DeleteUser(ctx context.Context, id primitive.ObjectID) (bool, error) {
-	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
-	if !isAuthenticated {
-		return false, fmt.Errorf("unauthorized")
+// UpdateMarker is the resolver for the updateMarker field.
+func (r *mutationResolver) UpdateMarker(ctx context.Context, id primitive.ObjectID, input model.UpdateMarkerInput) (*models.Marker, error) {
+	update, err := markerUpdate(input)
+	if err != nil {
+		return nil, err
 	}
-	log.Printf("DeleteUser: Requested by user ID %s to delete user ID %s", userClaims.UserID, id.Hex())
 
-	requesterID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	before, err := r.MarkerService.GetMarkerByID(ctx, id)
 	if err != nil {
-		return false, fmt.Errorf("invalid requester ID in token")
-	}
-	if requesterID == id {
-		return false, fmt.Errorf("cannot delete yourself")
+		return nil, fmt.Errorf("marker not found")
 	}
 
-	userToDelete, err := r.UserService.GetUserByID(ctx, id)
+	updated, err := r.MarkerService.UpdateMarker(ctx, id, update)
 	if err != nil {
-		if err.Error() == "user not found" {
-			return false, fmt.Errorf("user not found")
+		if errors.Is(err, mongo.ErrMarkerConflict) {
+			return nil, err
 		}
-		log.Printf("DeleteUser: Failed to get user %s: %v", id.Hex(), err)
-		return false, fmt.Errorf("failed to get user: %w", err)
+		log.Printf("UpdateMarker: Failed to update marker %s: %v", id.Hex(), err)
+		return nil, fmt.Errorf("failed to update marker")
 	}
 
-	requester, err := r.UserService.GetUserByID(ctx, requesterID)
+	summary := fmt.Sprintf("изменён корпус %s", updated.Label)
+	if updated.Label != before.Label {
+		summary = fmt.Sprintf("корпус %s переименован в %s", before.Label, updated.Label)
+	}
+	r.audit(ctx, models.AuditActionMarkerUpdate, summary,
+		[]primitive.ObjectID{id}, markerSnapshot(before), markerSnapshot(updated))
+
+	return updated, nil
+}
+
+// DeleteMarker is the resolver for the deleteMarker field.
+func (r *mutationResolver) DeleteMarker(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	marker, err := r.MarkerService.GetMarkerByID(ctx, id)
 	if err != nil {
-		log.Printf("DeleteUser: Failed to get requester %s: %v", requesterID.Hex(), err)
-		return false, fmt.Errorf("failed to get requester info: %w", err)
+		return false, fmt.Errorf("marker not found")
 	}
 
-	if !requester.HasEqualOrHigherRole(userToDelete.Role) {
-		log.Printf("DeleteUser: User %s (role %s) attempted to delete user %s (role %s) - forbidden by role hierarchy",
-			requesterID.Hex(), requester.Role, id.Hex(), userToDelete.Role)
-		return false, fmt.Errorf("insufficient permissions to delete user with role %s", userToDelete.Role)
+	detached, err := r.MarkerService.DeleteMarker(ctx, id)
+	if err != nil {
+		log.Printf("DeleteMarker: Failed to delete marker %s: %v", id.Hex(), err)
+		return false, fmt.Errorf("failed to delete marker")
 	}
+	log.Printf("DeleteMarker: Deleted marker %s ('%s'), detached %d users", id.Hex(), marker.Label, detached)
 
-	if len(userToDelete.Markers) > 0 {
-		log.Printf("DeleteUser: User %s has %d assigned markers, removing...", id.Hex(), len(userToDelete.Markers))
-		for _, markerID := range userToDelete.Markers {
-			err := r.MarkerService.RemoveUserFromMarker(ctx, id, markerID)
-			if err != nil {
-				log.Printf("Warning: Failed to remove user %s from marker %s during deletion: %v", id.Hex(), markerID.Hex(), err)
-			}
-		}
+	r.audit(ctx, models.AuditActionMarkerDelete,
+		fmt.Sprintf("удалён корпус %s, снято пользователей: %d", marker.Label, detached),
+		[]primitive.ObjectID{id}, markerSnapshot(marker), nil)
+
+	return true, nil
+}
+
+// ImportMarkersGeoJSON is the resolver for the importMarkersGeoJSON field.
+func (r *mutationResolver) ImportMarkersGeoJSON(ctx context.Context, file graphql.Upload, mode model.MarkerImportMode, dryRun bool) (*model.MarkerImportReport, error) {
+	requester, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("ImportMarkersGeoJSON: User %s uploaded %s (%d bytes), mode=%s, dryRun=%t",
+		requester.ID.Hex(), file.Filename, file.Size, mode, dryRun)
 
-	err = r.UserService.DeleteUser(ctx, id)
+	collection, err := formats.ReadFeatureCollection(file.File, maxImportFeatures)
 	if err != nil {
-		log.Printf("DeleteUser: Failed to delete user %s in service: %v", id.Hex(), err)
-		return false, fmt.Errorf("failed to delete user: %w", err)
+		return nil, err
 	}
 
-	log.Printf("DeleteUser: Successfully deleted user ID %s", id.Hex())
-	return true, nil
+	report, err := r.importMarkers(ctx, collection, mode, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("ImportMarkersGeoJSON: %d features, %d invalid, %d created, %d updated, %d deleted",
+		report.Total, report.Invalid, report.Created, report.Updated, report.Deleted)
+	return report, nil
 }
 
 // AssignUser is the resolver for the assignUser field.
@@ -191,7 +1368,12 @@ func (r *mutationResolver) AssignUser(ctx context.Context, input model.AssignUse
 	userID := input.UserID
 	markerID := input.MarkerID
 
-	err := r.MarkerService.AssignUserToMarker(ctx, userID, markerID)
+	before, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	err = r.MarkerService.AssignUserToMarker(ctx, userID, markerID)
 	if err != nil {
 		log.Printf("AssignUser: Failed to assign user %s to marker %s: %v", userID.Hex(), markerID.Hex(), err)
 		return nil, fmt.Errorf("could not assign user to marker: %w", err)
@@ -203,6 +1385,11 @@ func (r *mutationResolver) AssignUser(ctx context.Context, input model.AssignUse
 		return nil, fmt.Errorf("failed to fetch updated marker data")
 	}
 
+	after, _ := r.UserService.GetUserByID(ctx, userID)
+	r.audit(ctx, models.AuditActionMarkerAssignUser,
+		fmt.Sprintf("пользователь %s (%s) назначен в корпус %s", before.Login, before.Role, updatedMarker.Label),
+		[]primitive.ObjectID{userID, markerID}, placementSnapshot(before), placementSnapshot(after))
+
 	return updatedMarker, nil
 }
 
@@ -211,7 +1398,12 @@ func (r *mutationResolver) RemoveUser(ctx context.Context, input model.RemoveUse
 	userID := input.UserID
 	markerID := input.MarkerID
 
-	err := r.MarkerService.RemoveUserFromMarker(ctx, userID, markerID)
+	before, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	err = r.MarkerService.RemoveUserFromMarker(ctx, userID, markerID)
 	if err != nil {
 		log.Printf("RemoveUser: Failed to remove user %s from marker %s: %v", userID.Hex(), markerID.Hex(), err)
 		return nil, fmt.Errorf("could not remove user from marker: %w", err)
@@ -223,6 +1415,11 @@ func (r *mutationResolver) RemoveUser(ctx context.Context, input model.RemoveUse
 		return nil, fmt.Errorf("failed to fetch updated marker data")
 	}
 
+	after, _ := r.UserService.GetUserByID(ctx, userID)
+	r.audit(ctx, models.AuditActionMarkerRemoveUser,
+		fmt.Sprintf("пользователь %s (%s) снят с корпуса %s", before.Login, before.Role, updatedMarker.Label),
+		[]primitive.ObjectID{userID, markerID}, placementSnapshot(before), placementSnapshot(after))
+
 	return updatedMarker, nil
 }
 
@@ -268,6 +1465,9 @@ func (r *mutationResolver) SendNotification(ctx context.Context, input model.Sen
 	}
 
 	log.Printf("SendNotification: Sent notification '%s' from user %s to %d recipients", input.Title, senderID.Hex(), len(recipientIDs))
+	r.audit(ctx, models.AuditActionNotificationSend,
+		fmt.Sprintf("отправлено уведомление «%s» (%d получателей)", input.Title, len(recipientIDs)),
+		append([]primitive.ObjectID{notification.ID}, recipientIDs...), nil, notification)
 	return true, nil
 }
 
@@ -309,19 +1509,115 @@ func (r *mutationResolver) MarkNotificationAsRead(ctx context.Context, id primit
 	return true, nil
 }
 
+// CreateAPIKey is the resolver for the createApiKey field.
+func (r *mutationResolver) CreateAPIKey(ctx context.Context, name string, scopes []models.APIKeyScope, expiresAt *time.Time) (*model.CreatedAPIKey, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authentication data")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("api key name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return nil, fmt.Errorf("invalid api key scope: %s", scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expiresAt must be in the future")
+	}
+
+	apiKey := &models.APIKey{
+		Name:      name,
+		Scopes:    scopes,
+		OwnerID:   ownerID,
+		Role:      userClaims.Role,
+		ExpiresAt: expiresAt,
+	}
+
+	rawKey, err := r.APIKeyService.CreateAPIKey(ctx, apiKey)
+	if err != nil {
+		log.Printf("CreateApiKey: Failed to create api key for user %s: %v", userClaims.UserID, err)
+		return nil, fmt.Errorf("failed to create api key")
+	}
+
+	log.Printf("CreateApiKey: User %s created api key %s with scopes %v", userClaims.UserID, apiKey.ID.Hex(), scopes)
+	r.audit(ctx, models.AuditActionAPIKeyCreate, fmt.Sprintf("создан API-ключ %s (%s)", apiKey.Name, apiKey.Prefix),
+		[]primitive.ObjectID{apiKey.ID}, nil, apiKey)
+	return &model.CreatedAPIKey{Key: rawKey, APIKey: apiKey}, nil
+}
+
+// RevokeAPIKey is the resolver for the revokeApiKey field.
+func (r *mutationResolver) RevokeAPIKey(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	user, userClaims, err := r.currentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	apiKey, err := r.APIKeyService.GetAPIKeyByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	// Чужой ключ можно отозвать, только если его роль ниже своей
+	if apiKey.OwnerID != user.ID && !user.HasHigherRole(apiKey.Role) {
+		return false, fmt.Errorf("access denied: cannot revoke api key of a user with equal or higher role")
+	}
+
+	if err := r.APIKeyService.RevokeAPIKey(ctx, id); err != nil {
+		log.Printf("RevokeApiKey: Failed to revoke api key %s: %v", id.Hex(), err)
+		return false, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	r.audit(ctx, models.AuditActionAPIKeyRevoke, fmt.Sprintf("отозван API-ключ %s (%s)", apiKey.Name, apiKey.Prefix),
+		[]primitive.ObjectID{id}, apiKey, nil)
+
+	log.Printf("RevokeApiKey: User %s revoked api key %s", userClaims.UserID, id.Hex())
+	return true, nil
+}
+
 // Sender is the resolver for the sender field.
 func (r *notificationResolver) Sender(ctx context.Context, obj *models.Notification) (*model.NotificationSender, error) {
+	// Системные уведомления не имеют отправителя-пользователя; у окончательно удалённого
+	// отправителя вместо ID сохранено только имя-заглушка
+	if obj.SenderID.IsZero() {
+		fullName := "Система"
+		if obj.SenderName != "" {
+			fullName = obj.SenderName
+		}
+		return &model.NotificationSender{
+			ID:       primitive.NilObjectID,
+			FullName: fullName,
+		}, nil
+	}
+
 	// Получаем отправителя по ID из уведомления
 	user, err := r.UserService.GetUserByID(ctx, obj.SenderID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get sender user: %w", err)
+		// Отправитель мог быть окончательно удалён после истечения срока хранения
+		log.Printf("notificationResolver.Sender: Sender %s of notification %s is unavailable: %v", obj.SenderID.Hex(), obj.ID.Hex(), err)
+		return &model.NotificationSender{
+			ID:       obj.SenderID,
+			FullName: "Удалённый пользователь",
+		}, nil
 	}
 
-	// Создаем NotificationSender из данных пользователя
+	// Создаем NotificationSender из данных пользователя; корпус подчиняется тем же правилам видимости, что и User.building
 	sender := &model.NotificationSender{
 		ID:       user.ID,
 		FullName: user.FullName,
-		Building: user.Building,
+	}
+	if r.canViewUserField(ctx, user, models.UserFieldBuilding) {
+		sender.Building = user.Building
 	}
 
 	return sender, nil
@@ -351,7 +1647,7 @@ func (r *queryResolver) Me(ctx context.Context) (*models.User, error) {
 }
 
 // Users is the resolver for the users field.
-func (r *queryResolver) Users(ctx context.Context) ([]*models.User, error) {
+func (r *queryResolver) Users(ctx context.Context, filter *model.UsersFilter, first *int, after *string, orderBy *model.UserOrder) (*model.UserConnection, error) {
 	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
 	if !isAuthenticated {
 		return nil, fmt.Errorf("unauthorized: valid authentication required")
@@ -371,35 +1667,82 @@ func (r *queryResolver) Users(ctx context.Context) ([]*models.User, error) {
 		return nil, fmt.Errorf("could not retrieve requester information")
 	}
 
-	allUsers, err := r.UserService.GetUsers(ctx)
+	roles, err := userListRoles(requester, filter)
 	if err != nil {
-		log.Printf("Users query: Failed to retrieve users from service: %v", err)
-		return nil, fmt.Errorf("could not retrieve users list: %w", err)
-	}
-
-	var filteredUsers []*models.User
-	switch requester.Role {
-	case models.UserRoleDgis:
-		log.Printf("Users query: DGIS user, returning all %d users", len(allUsers))
-		filteredUsers = allUsers
-	case models.UserRolePredsedatel:
-		for _, user := range allUsers {
-			if user.Role == models.UserRoleStarosta || user.Role == models.UserRoleSupervisor {
-				filteredUsers = append(filteredUsers, user)
-			}
+		log.Printf("Users query: User with role %s passed @hasRole but has no visibility rule", requester.Role)
+		return nil, err
+	}
+
+	connection := &model.UserConnection{
+		Edges:    []*model.UserEdge{},
+		PageInfo: &model.PageInfo{},
+	}
+	// Запрошенные роли не пересекаются с видимыми: в Mongo ходить незачем
+	if roles != nil && len(roles) == 0 {
+		return connection, nil
+	}
+
+	userFilter := mongo.UserFilter{Roles: roles, Statuses: defaultListedStatuses}
+	if filter != nil {
+		if len(filter.Statuses) > 0 {
+			userFilter.Statuses = filter.Statuses
+		}
+		userFilter.Building = filter.Building
+		userFilter.MarkerID = filter.MarkerID
+		if filter.Search != nil {
+			userFilter.Search = strings.TrimSpace(*filter.Search)
+		}
+	}
+
+	order := mongo.UserOrder{Field: mongo.UserOrderByFullName}
+	if orderBy != nil {
+		order.Field = userOrderFields[orderBy.Field]
+		order.Descending = orderBy.Direction == model.OrderDirectionDesc
+	}
+
+	var cursor *mongo.UserCursor
+	if after != nil && *after != "" {
+		if cursor, err = mongo.DecodeUserCursor(*after, order); err != nil {
+			return nil, err
 		}
-		log.Printf("Users query: PREDSEDATEL user, returning %d users (STAROSTA and SUPERVISOR only)", len(filteredUsers))
-	default:
-		log.Printf("Users query: User with role %s attempted to access users list - this should be blocked by schema directives", requester.Role)
-		return nil, fmt.Errorf("access denied: insufficient permissions to view users list")
 	}
 
-	for _, user := range filteredUsers {
+	pageSize := defaultUsersPageSize
+	if first != nil && *first > 0 {
+		pageSize = min(*first, maxUsersPageSize)
+	}
+
+	// Запрашиваем на одного пользователя больше, чтобы понять, есть ли следующая страница
+	users, err := r.UserService.FindUsers(ctx, userFilter, order, cursor, int64(pageSize+1))
+	if err != nil {
+		log.Printf("Users query: Failed to retrieve users from service: %v", err)
+		return nil, fmt.Errorf("could not retrieve users list")
+	}
+	totalCount, err := r.UserService.CountUsers(ctx, userFilter)
+	if err != nil {
+		log.Printf("Users query: Failed to count users: %v", err)
+		return nil, fmt.Errorf("could not retrieve users list")
+	}
+
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		connection.PageInfo.HasNextPage = true
+	}
+	for _, user := range users {
 		user.Password = ""
+		connection.Edges = append(connection.Edges, &model.UserEdge{
+			Cursor: mongo.NewUserCursor(user, order).Encode(),
+			Node:   user,
+		})
+	}
+	if len(connection.Edges) > 0 {
+		endCursor := connection.Edges[len(connection.Edges)-1].Cursor
+		connection.PageInfo.EndCursor = &endCursor
 	}
+	connection.TotalCount = int(totalCount)
 
-	log.Printf("Users query: Successfully retrieved and filtered %d users for requester %s", len(filteredUsers), userClaims.UserID)
-	return filteredUsers, nil
+	log.Printf("Users query: Returning %d of %d users for requester %s", len(users), totalCount, userClaims.UserID)
+	return connection, nil
 }
 
 // Dashboard is the resolver for the dashboard field.
@@ -490,9 +1833,228 @@ func (r *queryResolver) UnreadNotificationsCount(ctx context.Context) (int, erro
 	return count, nil
 }
 
+// MySessions is the resolver for the mySessions field.
+func (r *queryResolver) MySessions(ctx context.Context) ([]*models.Session, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	sessions, err := r.SessionService.ListUserSessions(userClaims.UserID)
+	if err != nil {
+		log.Printf("MySessions: Failed to list sessions of user %s: %v", userClaims.UserID, err)
+		return nil, fmt.Errorf("could not retrieve sessions")
+	}
+
+	return sessions, nil
+}
+
+// APIKeys is the resolver for the apiKeys field.
+func (r *queryResolver) APIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	user, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := r.APIKeyService.GetAPIKeys(ctx, user)
+	if err != nil {
+		log.Printf("ApiKeys: Failed to list api keys: %v", err)
+		return nil, fmt.Errorf("could not retrieve api keys")
+	}
+	return keys, nil
+}
+
+// PendingInvites is the resolver for the pendingInvites field.
+func (r *queryResolver) PendingInvites(ctx context.Context) ([]*models.Invite, error) {
+	invites, err := r.InviteService.GetPendingInvites(ctx)
+	if err != nil {
+		log.Printf("PendingInvites: Failed to list invites: %v", err)
+		return nil, fmt.Errorf("could not retrieve invites")
+	}
+	return invites, nil
+}
+
+// AuditLog is the resolver for the auditLog field.
+func (r *queryResolver) AuditLog(ctx context.Context, filter *model.AuditLogFilter, cursor *string, limit *int) (*model.AuditLogPage, error) {
+	pageSize := defaultAuditPageSize
+	if limit != nil && *limit > 0 {
+		pageSize = min(*limit, maxAuditPageSize)
+	}
+
+	var auditFilter mongo.AuditFilter
+	if filter != nil {
+		auditFilter.ActorID = filter.ActorID
+		auditFilter.TargetID = filter.TargetID
+		auditFilter.From = filter.From
+		auditFilter.To = filter.To
+		for _, action := range filter.Actions {
+			auditFilter.Actions = append(auditFilter.Actions, models.AuditAction(action))
+		}
+	}
+
+	var after *primitive.ObjectID
+	if cursor != nil && *cursor != "" {
+		cursorID, err := primitive.ObjectIDFromHex(*cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		after = &cursorID
+	}
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	entries, err := r.AuditService.FindEntries(ctx, auditFilter, after, int64(pageSize+1))
+	if err != nil {
+		log.Printf("AuditLog: Failed to query audit log: %v", err)
+		return nil, fmt.Errorf("could not retrieve audit log")
+	}
+
+	page := &model.AuditLogPage{Entries: entries}
+	if len(entries) > pageSize {
+		page.Entries = entries[:pageSize]
+		nextCursor := page.Entries[pageSize-1].ID.Hex()
+		page.NextCursor = &nextCursor
+	}
+
+	return page, nil
+}
+
+// MarkerLinkReport is the resolver for the markerLinkReport field.
+func (r *queryResolver) MarkerLinkReport(ctx context.Context) (*model.LinkReport, error) {
+	report, err := r.MarkerService.CheckLinks(ctx)
+	if err != nil {
+		log.Printf("MarkerLinkReport: Failed to check marker links: %v", err)
+		return nil, fmt.Errorf("failed to check marker links")
+	}
+
+	result := &model.LinkReport{
+		MarkersScanned: report.MarkersScanned,
+		UsersScanned:   report.UsersScanned,
+		Issues:         make([]*model.LinkIssue, 0, len(report.Issues)),
+	}
+	for _, issue := range report.Issues {
+		result.Issues = append(result.Issues, &model.LinkIssue{
+			Kind:             model.LinkIssueKind(issue.Kind),
+			MarkerID:         issue.MarkerID,
+			UserID:           issue.UserID,
+			Building:         issue.Building,
+			ExpectedBuilding: issue.ExpectedBuilding,
+			Fix:              issue.Fix(),
+		})
+	}
+	return result, nil
+}
+
+// ExportMarkersGeoJSON is the resolver for the exportMarkersGeoJSON field.
+func (r *queryResolver) ExportMarkersGeoJSON(ctx context.Context) (map[string]any, error) {
+	markers, err := r.MarkerService.GetAllMarkersWithUsers(ctx)
+	if err != nil {
+		log.Printf("ExportMarkersGeoJSON: Failed to load markers: %v", err)
+		return nil, fmt.Errorf("failed to load markers")
+	}
+
+	collection, err := markersGeoJSON(markers)
+	if err != nil {
+		log.Printf("ExportMarkersGeoJSON: Failed to encode markers: %v", err)
+		return nil, fmt.Errorf("failed to export markers")
+	}
+	return collection, nil
+}
+
+// Current is the resolver for the current field.
+func (r *sessionResolver) Current(ctx context.Context, obj *models.Session) (bool, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return false, nil
+	}
+
+	return obj.ID == userClaims.SessionID(), nil
+}
+
 // UnreadNotificationsCountChanged is the resolver for the unreadNotificationsCountChanged field.
 func (r *subscriptionResolver) UnreadNotificationsCountChanged(ctx context.Context, userID primitive.ObjectID) (<-chan int, error) {
-	panic(fmt.Errorf("not implemented: UnreadNotificationsCountChanged - unreadNotificationsCountChanged"))
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	requesterID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID in token")
+	}
+
+	if requesterID != userID {
+		log.Printf("UnreadNotificationsCountChanged: User %s attempted to subscribe to notifications of user %s", requesterID.Hex(), userID.Hex())
+		return nil, fmt.Errorf("access denied: you can only subscribe to your own notifications")
+	}
+
+	pubsub := r.NotificationService.SubscribeUserNotificationChanged(userID)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		log.Printf("UnreadNotificationsCountChanged: Failed to subscribe user %s: %v", userID.Hex(), err)
+		return nil, fmt.Errorf("could not subscribe to notifications")
+	}
+
+	counts := make(chan int, 1)
+
+	go func() {
+		defer close(counts)
+		defer pubsub.Close()
+
+		send := func() bool {
+			count, err := r.NotificationService.GetUnreadCount(ctx, userID)
+			if err != nil {
+				log.Printf("UnreadNotificationsCountChanged: Failed to count for user %s: %v", userID.Hex(), err)
+				return true
+			}
+			select {
+			case counts <- count:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if !send() {
+			return
+		}
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("UnreadNotificationsCountChanged: User %s disconnected", userID.Hex())
+				return
+			case _, ok := <-messages:
+				if !ok {
+					return
+				}
+				if !send() {
+					return
+				}
+			}
+		}
+	}()
+
+	log.Printf("UnreadNotificationsCountChanged: User %s subscribed", userID.Hex())
+	return counts, nil
+}
+
+// Building is the resolver for the building field.
+func (r *userResolver) Building(ctx context.Context, obj *models.User) (*string, error) {
+	if !r.canViewUserField(ctx, obj, models.UserFieldBuilding) {
+		return nil, nil
+	}
+	return obj.Building, nil
+}
+
+// PhoneNumber is the resolver for the phoneNumber field.
+func (r *userResolver) PhoneNumber(ctx context.Context, obj *models.User) (*string, error) {
+	return r.visibleString(ctx, obj, models.UserFieldPhoneNumber, obj.PhoneNumber), nil
+}
+
+// TelegramTag is the resolver for the telegramTag field.
+func (r *userResolver) TelegramTag(ctx context.Context, obj *models.User) (*string, error) {
+	return r.visibleString(ctx, obj, models.UserFieldTelegramTag, obj.TelegramTag), nil
 }
 
 // Markers is the resolver for the markers field.
@@ -516,6 +2078,29 @@ func (r *userResolver) Markers(ctx context.Context, obj *models.User) ([]*models
 	return markers, nil
 }
 
+// LockedUntil is the resolver for the lockedUntil field.
+func (r *userResolver) LockedUntil(ctx context.Context, obj *models.User) (*time.Time, error) {
+	if !r.canViewUserField(ctx, obj, models.UserFieldLockedUntil) {
+		return nil, nil
+	}
+	return obj.LockedUntil, nil
+}
+
+// MustChangePassword is the resolver for the mustChangePassword field.
+func (r *userResolver) MustChangePassword(ctx context.Context, obj *models.User) (*bool, error) {
+	return r.visibleBool(ctx, obj, models.UserFieldMustChangePassword, obj.MustChangePassword), nil
+}
+
+// TwoFactorEnabled is the resolver for the twoFactorEnabled field.
+func (r *userResolver) TwoFactorEnabled(ctx context.Context, obj *models.User) (*bool, error) {
+	return r.visibleBool(ctx, obj, models.UserFieldTwoFactorEnabled, obj.TOTPEnabled), nil
+}
+
+// Status is the resolver for the status field.
+func (r *userResolver) Status(ctx context.Context, obj *models.User) (models.UserStatus, error) {
+	return obj.CurrentStatus(), nil
+}
+
 // Notification is the resolver for the notification field.
 func (r *userNotificationResolver) Notification(ctx context.Context, obj *models.UserNotification) (*models.Notification, error) {
 	notification, err := r.NotificationService.GetNotificationByID(ctx, obj.NotificationID)
@@ -526,6 +2111,15 @@ func (r *userNotificationResolver) Notification(ctx context.Context, obj *models
 	return notification, nil
 }
 
+// ApiKey returns ApiKeyResolver implementation.
+func (r *Resolver) ApiKey() ApiKeyResolver { return &apiKeyResolver{r} }
+
+// AuditEntry returns AuditEntryResolver implementation.
+func (r *Resolver) AuditEntry() AuditEntryResolver { return &auditEntryResolver{r} }
+
+// Invite returns InviteResolver implementation.
+func (r *Resolver) Invite() InviteResolver { return &inviteResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
@@ -535,6 +2129,9 @@ func (r *Resolver) Notification() NotificationResolver { return &notificationRes
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// Session returns SessionResolver implementation.
+func (r *Resolver) Session() SessionResolver { return &sessionResolver{r} }
+
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
@@ -544,9 +2141,13 @@ func (r *Resolver) User() UserResolver { return &userResolver{r} }
 // UserNotification returns UserNotificationResolver implementation.
 func (r *Resolver) UserNotification() UserNotificationResolver { return &userNotificationResolver{r} }
 
+type apiKeyResolver struct{ *Resolver }
+type auditEntryResolver struct{ *Resolver }
+type inviteResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type notificationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type sessionResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
 type userNotificationResolver struct{ *Resolver }
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/google/uuid"
+)
+
+// completeLogin завершает вход после проверки первого фактора: при включённой 2FA
+// выдаёт challenge для verifyTwoFactor, иначе сразу открывает сессию
+func (r *Resolver) completeLogin(ctx context.Context, user *models.User) (*model.AuthPayload, error) {
+	if user.TOTPEnabled {
+		challengeToken, err := r.TwoFactorService.CreateChallenge(user.ID.Hex(), loginChallengeTTL)
+		if err != nil {
+			log.Printf("completeLogin: Failed to create two-factor challenge for user %s: %v", user.Login, err)
+			return nil, fmt.Errorf("login is temporarily unavailable")
+		}
+		log.Printf("completeLogin: First factor accepted for user %s, waiting for second factor", user.Login)
+		return &model.AuthPayload{
+			TwoFactorRequired: true,
+			ChallengeToken:    &challengeToken,
+		}, nil
+	}
+
+	tokenString, err := r.issueSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AuthPayload{
+		Token: &tokenString,
+		User:  user,
+	}, nil
+}
+
+// issueSession создаёт серверную сессию пользователя и выдаёт для неё пару токенов
+func (r *Resolver) issueSession(ctx context.Context, user *models.User) (string, error) {
+	session := &models.Session{
+		ID:        uuid.NewString(),
+		UserID:    user.ID.Hex(),
+		UserAgent: middleware.GetUserAgentFromContext(ctx),
+		IP:        middleware.GetClientIPFromContext(ctx),
+	}
+	if err := r.SessionService.CreateSession(session, auth.GetRefreshTokenDuration()); err != nil {
+		log.Printf("issueSession: Failed to create session for user %s: %v", user.Login, err)
+		return "", fmt.Errorf("could not create session")
+	}
+
+	return r.issueTokens(ctx, user, session)
+}
+
+// issueTokens выпускает access-токен и новый refresh-токен сессии и выставляет оба cookie
+func (r *Resolver) issueTokens(ctx context.Context, user *models.User, session *models.Session) (string, error) {
+	tokenString, err := r.JWTManager.GenerateToken(user, session.ID, r.TwoFactorPolicy.SetupRequired(user))
+	if err != nil {
+		log.Printf("issueTokens: Failed to generate token for user %s: %v", user.Login, err)
+		return "", fmt.Errorf("could not generate authentication token")
+	}
+
+	refreshToken, err := r.SessionService.IssueRefreshToken(session.ID, session.UserID, auth.GetRefreshTokenDuration())
+	if err != nil {
+		log.Printf("issueTokens: Failed to issue refresh token for user %s: %v", user.Login, err)
+		return "", fmt.Errorf("could not generate authentication token")
+	}
+
+	writer, err := middleware.GetResponseWriterFromContext(ctx)
+	if err != nil {
+		log.Printf("issueTokens: CRITICAL - Could not get ResponseWriter from context: %v", err)
+		return "", fmt.Errorf("internal error (token generated, but could not set cookie)")
+	}
+
+	middleware.SignalSetAuthCookieDirect(writer, tokenString)
+	middleware.SignalSetRefreshCookieDirect(writer, refreshToken)
+
+	return tokenString, nil
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
+)
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func telegramLoginData(input model.TelegramLoginInput) *auth.TelegramLoginData {
+	return &auth.TelegramLoginData{
+		ID:        input.ID,
+		FirstName: stringValue(input.FirstName),
+		LastName:  stringValue(input.LastName),
+		Username:  stringValue(input.Username),
+		PhotoURL:  stringValue(input.PhotoURL),
+		AuthDate:  int64(input.AuthDate),
+		Hash:      input.Hash,
+	}
+}
+
+// telegramThrottleKey — ключ учёта неудачных попыток входа через Telegram
+func telegramThrottleKey(telegramID string) string {
+	return "telegram:" + telegramID
+}
+
+// checkTelegramLink разрешает привязку только аккаунта Telegram, username которого совпадает с
+// telegramTag из профиля, и только если Telegram ещё не привязан: сменить привязку можно через unlinkMyTelegram
+func checkTelegramLink(user *models.User, data *auth.TelegramLoginData) error {
+	if user.TelegramID != "" {
+		return mongo.ErrTelegramAlreadyLinked
+	}
+	if user.TelegramTag == "" {
+		return fmt.Errorf("telegram tag is not set in the profile")
+	}
+	username, err := models.NormalizeTelegramTag("@" + data.Username)
+	if err != nil || !strings.EqualFold(username, user.TelegramTag) {
+		return fmt.Errorf("telegram account does not match the telegram tag in the profile")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
+)
+
+// Фикстуры подписаны токеном testBotToken по алгоритму Telegram Login Widget.
+// Подписаны они заранее, поэтому верификатор не ограничивает их возраст.
+const testBotToken = "123456789:TEST-bot-token"
+
+func signedTelegramInput() model.TelegramLoginInput {
+	firstName, lastName, username, photoURL := "Иван", "Петров", "ivan_petrov", "https://t.me/i/userpic/320/ivan.jpg"
+	return model.TelegramLoginInput{
+		ID:        "987654321",
+		FirstName: &firstName,
+		LastName:  &lastName,
+		Username:  &username,
+		PhotoURL:  &photoURL,
+		AuthDate:  1760000000,
+		Hash:      "49723ab7deb83fff43b99761f21d50c0e323de1333ca26e08a1a07b0b51203b3",
+	}
+}
+
+func signedTelegramInputWithoutUsername() model.TelegramLoginInput {
+	firstName := "Иван"
+	return model.TelegramLoginInput{
+		ID:        "987654321",
+		FirstName: &firstName,
+		AuthDate:  1760000000,
+		Hash:      "53d22172ba31fd2eb21d170bb24c999c18b42063adaa851e177e34f8504f07a7",
+	}
+}
+
+func TestCheckTelegramLink(t *testing.T) {
+	verifier := auth.NewTelegramVerifier(testBotToken, 100*365*24*time.Hour)
+
+	tests := []struct {
+		name      string
+		input     model.TelegramLoginInput
+		user      *models.User
+		wantErr   bool
+		wantErrIs error
+	}{
+		{"matching tag", signedTelegramInput(), &models.User{TelegramTag: "@ivan_petrov"}, false, nil},
+		{"tag differs in case", signedTelegramInput(), &models.User{TelegramTag: "@Ivan_Petrov"}, false, nil},
+		{"tag mismatch", signedTelegramInput(), &models.User{TelegramTag: "@someone_else"}, true, nil},
+		{"no tag in profile", signedTelegramInput(), &models.User{}, true, nil},
+		{"telegram without username", signedTelegramInputWithoutUsername(), &models.User{TelegramTag: "@ivan_petrov"}, true, nil},
+		{"relink to another account", signedTelegramInput(),
+			&models.User{TelegramTag: "@ivan_petrov", TelegramID: "123456"}, true, mongo.ErrTelegramAlreadyLinked},
+		{"relink to the same account", signedTelegramInput(),
+			&models.User{TelegramTag: "@ivan_petrov", TelegramID: "987654321"}, true, mongo.ErrTelegramAlreadyLinked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := telegramLoginData(tt.input)
+			if err := verifier.Verify(data); err != nil {
+				t.Fatalf("fixture does not verify: %v", err)
+			}
+
+			err := checkTelegramLink(tt.user, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("error = %v, want %v", err, tt.wantErrIs)
+			}
+		})
+	}
+}
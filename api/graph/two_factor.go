@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Время на ввод кода после успешной проверки пароля
+	loginChallengeTTL = 5 * time.Minute
+	// Отметка об использованном TOTP-коде должна пережить окно допуска в ±1 шаг
+	usedTOTPCodeTTL = 2 * time.Minute
+)
+
+// TwoFactorSetupGuard оставляет пользователю, обязанному подключить 2FA, только подключение
+func TwoFactorSetupGuard(ctx context.Context, next graphql.RootResolver) graphql.Marshaler {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return next(ctx)
+	}
+
+	field := graphql.GetRootFieldContext(ctx).Field
+	if err := middleware.CheckTwoFactorSetup(userClaims, field.Name); err != nil {
+		return rejectRootField(ctx, field, err)
+	}
+	return next(ctx)
+}
+
+// verifySecondFactor принимает TOTP-код или код восстановления; каждый код действует один раз
+func (r *Resolver) verifySecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if !user.TOTPEnabled {
+		return false, nil
+	}
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		return r.TwoFactorService.MarkCodeUsed(user.ID.Hex(), step, usedTOTPCodeTTL)
+	}
+
+	used, err := r.UserService.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	if used {
+		log.Printf("verifySecondFactor: User %s used a recovery code", user.ID.Hex())
+	}
+	return used, nil
+}
+
+// authorizeTwoFactorReset, как и сброс пароля, разрешает сбрасывать 2FA только пользователю с ролью
+// строго ниже своей: иначе равный по роли мог бы снять второй фактор с защищённой им учётной записи
+func authorizeTwoFactorReset(requester, user *models.User) error {
+	if !requester.HasHigherRole(user.Role) {
+		return fmt.Errorf("insufficient permissions to reset two-factor authentication of user with role %s", user.Role)
+	}
+	return nil
+}
+
+// currentUser загружает пользователя, от имени которого выполняется запрос
+func (r *Resolver) currentUser(ctx context.Context) (*models.User, *auth.JWTClaims, error) {
+	userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+	if !isAuthenticated {
+		return nil, nil, fmt.Errorf("unauthorized")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid authentication data")
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve user information")
+	}
+
+	return user, userClaims, nil
+}
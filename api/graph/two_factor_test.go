@@ -0,0 +1,30 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/DGISsoft/DGISback/models"
+)
+
+func TestAuthorizeTwoFactorReset(t *testing.T) {
+	tests := []struct {
+		name      string
+		requester models.UserRole
+		target    models.UserRole
+		wantErr   bool
+	}{
+		{"dgis resets starosta", models.UserRoleDgis, models.UserRoleStarosta, false},
+		{"predsedatel resets dgis", models.UserRolePredsedatel, models.UserRoleDgis, false},
+		{"dgis cannot reset another dgis", models.UserRoleDgis, models.UserRoleDgis, true},
+		{"predsedatel cannot reset another predsedatel", models.UserRolePredsedatel, models.UserRolePredsedatel, true},
+		{"dgis cannot reset predsedatel", models.UserRoleDgis, models.UserRolePredsedatel, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizeTwoFactorReset(&models.User{Role: tt.requester}, &models.User{Role: tt.target})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/DGISsoft/DGISback/api/formats"
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Одного файла хватает на заселение всех корпусов; больше — скорее всего ошибка выгрузки
+const maxImportRows = 1000
+
+type importColumns struct {
+	login, password, role, fullName, building, phoneNumber, telegramTag int
+}
+
+func findImportColumns(table *formats.Table) (importColumns, error) {
+	columns := importColumns{
+		login:       table.Column("login"),
+		password:    table.Column("password"),
+		role:        table.Column("role"),
+		fullName:    table.Column("fullName", "full_name"),
+		building:    table.Column("building"),
+		phoneNumber: table.Column("phoneNumber", "phone_number", "phone"),
+		telegramTag: table.Column("telegramTag", "telegram_tag", "telegram"),
+	}
+
+	required := []struct {
+		name  string
+		index int
+	}{
+		{"login", columns.login},
+		{"password", columns.password},
+		{"role", columns.role},
+		{"fullName", columns.fullName},
+		{"phoneNumber", columns.phoneNumber},
+		{"telegramTag", columns.telegramTag},
+	}
+	var missing []string
+	for _, column := range required {
+		if column.index < 0 {
+			missing = append(missing, column.name)
+		}
+	}
+	if len(missing) > 0 {
+		return columns, fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+type importRow struct {
+	report   *model.UserImportRow
+	user     *models.User
+	password string
+}
+
+// parseImportRow проверяет строку по тем же правилам, что и createUser
+func (r *Resolver) parseImportRow(requester *models.User, columns importColumns, number int, record []string) *importRow {
+	login := formats.Cell(record, columns.login)
+	row := &importRow{
+		report: &model.UserImportRow{Row: number, Errors: []string{}},
+		user: &models.User{
+			Login:              login,
+			Role:               models.UserRole(strings.ToUpper(formats.Cell(record, columns.role))),
+			Status:             models.UserStatusActive,
+			MustChangePassword: true,
+			Markers:            []primitive.ObjectID{},
+		},
+		password: formats.Cell(record, columns.password),
+	}
+	if login != "" {
+		row.report.Login = &login
+	}
+	fail := func(err error) {
+		row.report.Errors = append(row.report.Errors, err.Error())
+	}
+
+	if login == "" {
+		fail(fmt.Errorf("login is required"))
+	}
+	if !row.user.Role.IsValid() {
+		fail(fmt.Errorf("invalid user role: %s", formats.Cell(record, columns.role)))
+	} else if !requester.HasEqualOrHigherRole(row.user.Role) {
+		fail(fmt.Errorf("insufficient permissions to create user with role %s", row.user.Role))
+	}
+
+	var err error
+	if row.user.FullName, err = models.NormalizeFullName(formats.Cell(record, columns.fullName)); err != nil {
+		fail(err)
+	}
+	if row.user.PhoneNumber, err = models.NormalizePhoneNumber(formats.Cell(record, columns.phoneNumber)); err != nil {
+		fail(err)
+	}
+	if row.user.TelegramTag, err = models.NormalizeTelegramTag(formats.Cell(record, columns.telegramTag)); err != nil {
+		fail(err)
+	}
+	if building := formats.Cell(record, columns.building); building != "" {
+		row.user.Building = &building
+	}
+
+	if row.password == "" {
+		fail(fmt.Errorf("password is required"))
+	} else if err := r.PasswordPolicy.Validate(row.password, login, row.user.TelegramTag, row.user.PhoneNumber); err != nil {
+		fail(err)
+	}
+
+	return row
+}
+
+// userImportStore — методы UserService, которыми пользуется импорт
+type userImportStore interface {
+	ExistingLogins(ctx context.Context, logins []string) ([]string, error)
+	TelegramTagTaken(ctx context.Context, tag string, exceptID primitive.ObjectID) (bool, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// checkImportLogins помечает логины, повторяющиеся в файле или уже занятые в базе
+func checkImportLogins(ctx context.Context, store userImportStore, rows []*importRow) error {
+	firstRow := map[string]int{}
+	var logins []string
+	for _, row := range rows {
+		login := row.user.Login
+		if login == "" {
+			continue
+		}
+		if first, seen := firstRow[login]; seen {
+			row.report.Errors = append(row.report.Errors, fmt.Sprintf("duplicate login '%s', first used in row %d", login, first))
+			continue
+		}
+		firstRow[login] = row.report.Row
+		logins = append(logins, login)
+	}
+	if len(logins) == 0 {
+		return nil
+	}
+
+	existing, err := store.ExistingLogins(ctx, logins)
+	if err != nil {
+		return err
+	}
+	taken := map[string]bool{}
+	for _, login := range existing {
+		taken[login] = true
+	}
+	for _, row := range rows {
+		if taken[row.user.Login] {
+			row.report.Errors = append(row.report.Errors, fmt.Sprintf("user with login '%s' already exists", row.user.Login))
+		}
+	}
+	return nil
+}
+
+// checkImportTelegramTags помечает теги Telegram, повторяющиеся в файле или уже указанные у других пользователей.
+// Username в Telegram регистронезависим, поэтому @Ivanov и @ivanov считаются одним тегом.
+func checkImportTelegramTags(ctx context.Context, store userImportStore, rows []*importRow) error {
+	firstRow := map[string]int{}
+	for _, row := range rows {
+		tag := row.user.TelegramTag
+		if tag == "" {
+			continue
+		}
+		key := strings.ToLower(tag)
+		if first, seen := firstRow[key]; seen {
+			row.report.Errors = append(row.report.Errors, fmt.Sprintf("duplicate telegram tag %s, first used in row %d", tag, first))
+			continue
+		}
+		firstRow[key] = row.report.Row
+
+		taken, err := store.TelegramTagTaken(ctx, tag, primitive.NilObjectID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			row.report.Errors = append(row.report.Errors, fmt.Sprintf("telegram tag %s is already used by another user", tag))
+		}
+	}
+	return nil
+}
+
+func createImportedUser(ctx context.Context, store userImportStore, row *importRow) error {
+	// Пароль задаётся заново на каждую попытку: CreateUser заменяет его хешем
+	row.user.Password = row.password
+	if err := store.CreateUser(ctx, row.user); err != nil {
+		log.Printf("importUsers: Failed to create user '%s' from row %d: %v", row.user.Login, row.report.Row, err)
+		return err
+	}
+	return nil
+}
+
+// createImportUsers создаёт пользователей из строк со статусом VALID и возвращает созданные.
+// Без partial импорт атомарен: при ошибке в файле никто не создаётся, а строки создаются одной транзакцией,
+// и если не удалась одна, откатываются все. С partial каждая строка создаётся отдельно.
+func createImportUsers(ctx context.Context, store userImportStore, rows []*importRow, partial bool) ([]*importRow, error) {
+	var valid []*importRow
+	invalid := false
+	for _, row := range rows {
+		switch row.report.Status {
+		case model.UserImportRowStatusValid:
+			valid = append(valid, row)
+		case model.UserImportRowStatusInvalid:
+			invalid = true
+		}
+	}
+
+	if partial {
+		var created []*importRow
+		for _, row := range valid {
+			if err := createImportedUser(ctx, store, row); err != nil {
+				row.report.Status = model.UserImportRowStatusFailed
+				row.report.Errors = append(row.report.Errors, "failed to create user")
+				continue
+			}
+			created = append(created, row)
+		}
+		return created, nil
+	}
+
+	skip := func() {
+		for _, row := range valid {
+			row.report.Status = model.UserImportRowStatusSkipped
+		}
+	}
+	if invalid {
+		skip()
+		return nil, nil
+	}
+
+	var failed *importRow
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		failed = nil
+		for _, row := range valid {
+			if err := createImportedUser(ctx, store, row); err != nil {
+				failed = row
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if failed == nil {
+			log.Printf("importUsers: Failed to commit import: %v", err)
+			return nil, fmt.Errorf("failed to import users")
+		}
+		skip()
+		failed.report.Status = model.UserImportRowStatusFailed
+		failed.report.Errors = append(failed.report.Errors, "failed to create user")
+		return nil, nil
+	}
+	return valid, nil
+}
+
+// importUsers проверяет все строки и, если это не dryRun, создаёт пользователей.
+// Без partial при любой ошибке не создаётся никто, см. createImportUsers.
+func (r *Resolver) importUsers(ctx context.Context, requester *models.User, table *formats.Table, dryRun, partial bool) (*model.UserImportReport, error) {
+	columns, err := findImportColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*importRow, 0, len(table.Rows))
+	for i, record := range table.Rows {
+		rows = append(rows, r.parseImportRow(requester, columns, table.FirstRow+i, record))
+	}
+	if err := checkImportLogins(ctx, r.UserService, rows); err != nil {
+		log.Printf("importUsers: Failed to check existing logins: %v", err)
+		return nil, fmt.Errorf("could not validate import")
+	}
+	if err := checkImportTelegramTags(ctx, r.UserService, rows); err != nil {
+		log.Printf("importUsers: Failed to check telegram tags: %v", err)
+		return nil, fmt.Errorf("could not validate import")
+	}
+
+	report := &model.UserImportReport{DryRun: dryRun, Total: len(rows), Rows: make([]*model.UserImportRow, 0, len(rows))}
+	for _, row := range rows {
+		if len(row.report.Errors) > 0 {
+			row.report.Status = model.UserImportRowStatusInvalid
+			report.Invalid++
+		} else {
+			row.report.Status = model.UserImportRowStatusValid
+		}
+		report.Rows = append(report.Rows, row.report)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	created, err := createImportUsers(ctx, r.UserService, rows, partial)
+	if err != nil {
+		return nil, err
+	}
+
+	var createdIDs []primitive.ObjectID
+	for _, row := range created {
+		user := row.user
+		// Корпус назначается уже после создания: его ошибка не отменяет импорт, но попадает в отчёт по строке
+		if err := r.assignUserToBuilding(ctx, user); err != nil {
+			row.report.Errors = append(row.report.Errors, err.Error())
+		}
+		user.Password = ""
+		row.report.Status = model.UserImportRowStatusCreated
+		row.report.User = user
+		createdIDs = append(createdIDs, user.ID)
+		report.Created++
+	}
+
+	if len(createdIDs) > 0 {
+		r.audit(ctx, models.AuditActionUserImport, fmt.Sprintf("импортировано пользователей: %d из %d", report.Created, report.Total),
+			createdIDs, nil, map[string]any{"created": report.Created, "invalid": report.Invalid, "total": report.Total})
+	}
+	return report, nil
+}
@@ -0,0 +1,212 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testImportColumns = importColumns{login: 0, password: 1, role: 2, fullName: 3, building: 4, phoneNumber: 5, telegramTag: 6}
+
+type fakeImportStore struct {
+	existing     []string
+	existingTags []string
+	failLogin    string
+	created      []string
+}
+
+func (s *fakeImportStore) ExistingLogins(ctx context.Context, logins []string) ([]string, error) {
+	var found []string
+	for _, login := range logins {
+		if slices.Contains(s.existing, login) {
+			found = append(found, login)
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeImportStore) TelegramTagTaken(ctx context.Context, tag string, exceptID primitive.ObjectID) (bool, error) {
+	return slices.ContainsFunc(s.existingTags, func(existing string) bool { return strings.EqualFold(existing, tag) }), nil
+}
+
+func (s *fakeImportStore) CreateUser(ctx context.Context, user *models.User) error {
+	if user.Login == s.failLogin {
+		return errors.New("insert failed")
+	}
+	user.ID = primitive.NewObjectID()
+	user.Password = "hashed:" + user.Password
+	s.created = append(s.created, user.Login)
+	return nil
+}
+
+// WithTransaction откатывает созданных пользователей, если fn вернула ошибку
+func (s *fakeImportStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	created := len(s.created)
+	if err := fn(ctx); err != nil {
+		s.created = s.created[:created]
+		return err
+	}
+	return nil
+}
+
+func testImportResolver() *Resolver {
+	return &Resolver{PasswordPolicy: &auth.PasswordPolicy{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true}}
+}
+
+func TestParseImportRow(t *testing.T) {
+	r := testImportResolver()
+	requester := &models.User{Role: models.UserRoleDgis}
+
+	row := r.parseImportRow(requester, testImportColumns, 2,
+		[]string{"ivanov", "Secret-Pass1", "starosta", "Иванов  Иван", "Корпус 1", "+7 (999) 123-45-67", "ivanov_tg"})
+	if len(row.report.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", row.report.Errors)
+	}
+	user := row.user
+	if user.Role != models.UserRoleStarosta || user.FullName != "Иванов Иван" || user.PhoneNumber != "+79991234567" || user.TelegramTag != "@ivanov_tg" {
+		t.Errorf("user not normalized: %+v", user)
+	}
+	if user.Building == nil || *user.Building != "Корпус 1" || !user.MustChangePassword || user.Status != models.UserStatusActive {
+		t.Errorf("unexpected user defaults: %+v", user)
+	}
+	if row.report.Login == nil || *row.report.Login != "ivanov" {
+		t.Errorf("report login = %v", row.report.Login)
+	}
+
+	tests := []struct {
+		name   string
+		record []string
+		errors int
+	}{
+		{"empty row", []string{}, 6},
+		{"role above requester", []string{"boss", "Secret-Pass1", "PREDSEDATEL", "Босс", "", "+79991234567", "boss_tg"}, 1},
+		{"unknown role", []string{"petrov", "Secret-Pass1", "ADMIN", "Петров", "", "+79991234567", "petrov_tg"}, 1},
+		{"weak password", []string{"petrov", "petrov", "SUPERVISOR", "Петров", "", "+79991234567", "petrov_tg"}, 1},
+		{"bad phone and tag", []string{"petrov", "Secret-Pass1", "SUPERVISOR", "Петров", "", "8999", "1tag"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := r.parseImportRow(requester, testImportColumns, 3, tt.record)
+			if len(row.report.Errors) != tt.errors {
+				t.Errorf("got %d errors %v, want %d", len(row.report.Errors), row.report.Errors, tt.errors)
+			}
+		})
+	}
+}
+
+func importRows(logins ...string) []*importRow {
+	rows := make([]*importRow, 0, len(logins))
+	for i, login := range logins {
+		rows = append(rows, &importRow{
+			report:   &model.UserImportRow{Row: i + 2, Status: model.UserImportRowStatusValid, Errors: []string{}},
+			user:     &models.User{Login: login},
+			password: "Secret-Pass1",
+		})
+	}
+	return rows
+}
+
+func TestCheckImportLogins(t *testing.T) {
+	rows := importRows("ivanov", "petrov", "ivanov", "", "sidorov")
+	store := &fakeImportStore{existing: []string{"sidorov"}}
+
+	if err := checkImportLogins(context.Background(), store, rows); err != nil {
+		t.Fatalf("checkImportLogins: %v", err)
+	}
+
+	want := []string{"", "", "duplicate login 'ivanov', first used in row 2", "", "user with login 'sidorov' already exists"}
+	for i, row := range rows {
+		got := ""
+		if len(row.report.Errors) > 0 {
+			got = row.report.Errors[0]
+		}
+		if got != want[i] || len(row.report.Errors) > 1 {
+			t.Errorf("row %d: errors %v, want %q", row.report.Row, row.report.Errors, want[i])
+		}
+	}
+}
+
+func TestCheckImportTelegramTags(t *testing.T) {
+	rows := importRows("ivanov", "petrov", "sidorov", "kozlov", "orlov")
+	for i, tag := range []string{"@ivanov", "@Petrov", "@IVANOV", "", "@taken"} {
+		rows[i].user.TelegramTag = tag
+	}
+	store := &fakeImportStore{existingTags: []string{"@Taken"}}
+
+	if err := checkImportTelegramTags(context.Background(), store, rows); err != nil {
+		t.Fatalf("checkImportTelegramTags: %v", err)
+	}
+
+	want := []string{"", "", "duplicate telegram tag @IVANOV, first used in row 2", "", "telegram tag @taken is already used by another user"}
+	for i, row := range rows {
+		got := ""
+		if len(row.report.Errors) > 0 {
+			got = row.report.Errors[0]
+		}
+		if got != want[i] || len(row.report.Errors) > 1 {
+			t.Errorf("row %d: errors %v, want %q", row.report.Row, row.report.Errors, want[i])
+		}
+	}
+}
+
+func importStatuses(rows []*importRow) []model.UserImportRowStatus {
+	statuses := make([]model.UserImportRowStatus, 0, len(rows))
+	for _, row := range rows {
+		statuses = append(statuses, row.report.Status)
+	}
+	return statuses
+}
+
+func TestCreateImportUsers(t *testing.T) {
+	const (
+		valid   = model.UserImportRowStatusValid
+		invalid = model.UserImportRowStatusInvalid
+		skipped = model.UserImportRowStatusSkipped
+		failed  = model.UserImportRowStatusFailed
+	)
+
+	tests := []struct {
+		name      string
+		partial   bool
+		invalid   bool
+		failLogin string
+		created   []string
+		statuses  []model.UserImportRowStatus
+	}{
+		{"all valid", false, false, "", []string{"a", "b", "c"}, []model.UserImportRowStatus{valid, valid, valid}},
+		{"invalid row skips the rest", false, true, "", nil, []model.UserImportRowStatus{skipped, invalid, skipped}},
+		{"insert failure rolls back", false, false, "c", nil, []model.UserImportRowStatus{skipped, skipped, failed}},
+		{"partial with invalid row", true, true, "", []string{"a", "c"}, []model.UserImportRowStatus{valid, invalid, valid}},
+		{"partial insert failure", true, false, "b", []string{"a", "c"}, []model.UserImportRowStatus{valid, failed, valid}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := importRows("a", "b", "c")
+			if tt.invalid {
+				rows[1].report.Status = invalid
+			}
+			store := &fakeImportStore{failLogin: tt.failLogin}
+
+			created, err := createImportUsers(context.Background(), store, rows, tt.partial)
+			if err != nil {
+				t.Fatalf("createImportUsers: %v", err)
+			}
+			if !slices.Equal(store.created, tt.created) {
+				t.Errorf("stored users = %v, want %v", store.created, tt.created)
+			}
+			if len(created) != len(tt.created) {
+				t.Errorf("returned %d created rows, want %d", len(created), len(tt.created))
+			}
+			if got := importStatuses(rows); !slices.Equal(got, tt.statuses) {
+				t.Errorf("statuses = %v, want %v", got, tt.statuses)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authorizeLifecycleChange — общие проверки для deactivateUser, restoreUser и deleteUser:
+// себя менять нельзя, чужую роль — только не выше своей
+func (r *Resolver) authorizeLifecycleChange(ctx context.Context, id primitive.ObjectID, action string) (*models.User, *models.User, error) {
+	requester, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if requester.ID == id {
+		return nil, nil, fmt.Errorf("cannot %s yourself", action)
+	}
+
+	user, err := r.UserService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("user not found")
+	}
+
+	if !requester.HasEqualOrHigherRole(user.Role) {
+		log.Printf("authorizeLifecycleChange: User %s (role %s) attempted to %s user %s (role %s) - forbidden by role hierarchy",
+			requester.ID.Hex(), requester.Role, action, id.Hex(), user.Role)
+		return nil, nil, fmt.Errorf("insufficient permissions to %s user with role %s", action, user.Role)
+	}
+
+	return requester, user, nil
+}
+
+// revokeUserAccess завершает сессии и отзывает API-ключи пользователя, которому закрыт вход
+func (r *Resolver) revokeUserAccess(ctx context.Context, user *models.User) {
+	if _, err := r.SessionService.RevokeUserSessions(user.ID.Hex(), ""); err != nil {
+		log.Printf("revokeUserAccess: Failed to revoke sessions of user %s: %v", user.ID.Hex(), err)
+	}
+	if _, err := r.APIKeyService.RevokeOwnerAPIKeys(ctx, user.ID); err != nil {
+		log.Printf("revokeUserAccess: Failed to revoke api keys of user %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, пробывших в статусе DELETED дольше retention
+func (r *Resolver) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int, error) {
+	users, err := r.UserService.GetUsersDeletedBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if _, err := r.purgeUser(ctx, user); err != nil {
+			log.Printf("PurgeDeletedUsers: Failed to purge user %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// purgeUser окончательно удаляет пользователя, уже помеченного DELETED, вместе со ссылками на него.
+// Если пользователя тем временем восстановили, возвращает mongo.ErrUserNotDeleted и ничего не меняет.
+func (r *Resolver) purgeUser(ctx context.Context, user *models.User) (*mongo.DeleteUserResult, error) {
+	result, err := mongo.CascadeDeleteUser(ctx, r.UserCascade, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !result.UserDeleted {
+		return nil, mongo.ErrUserNotDeleted
+	}
+
+	r.audit(ctx, models.AuditActionUserPurge, fmt.Sprintf("окончательно удалён пользователь %s (%s)", user.Login, user.Role),
+		append([]primitive.ObjectID{user.ID}, user.Markers...), user, map[string]any{
+			"markersDetached":         result.MarkersDetached,
+			"inboxRemoved":            result.InboxRemoved,
+			"notificationsAnonymized": result.NotificationsAnonymized,
+		})
+	return result, nil
+}
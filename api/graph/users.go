@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 200
+)
+
+// Удалённые пользователи в списке показываются только по явному фильтру statuses
+var defaultListedStatuses = []models.UserStatus{models.UserStatusPending, models.UserStatusActive, models.UserStatusDeactivated}
+
+var userOrderFields = map[model.UserOrderField]mongo.UserOrderField{
+	model.UserOrderFieldFullName:  mongo.UserOrderByFullName,
+	model.UserOrderFieldLogin:     mongo.UserOrderByLogin,
+	model.UserOrderFieldCreatedAt: mongo.UserOrderByCreatedAt,
+}
+
+// userListRoles пересекает роли из фильтра с видимыми для requester, чтобы ограничение
+// применялось в самом запросе к Mongo. nil — без ограничения, пустой срез — ничего не найдётся.
+func userListRoles(requester *models.User, filter *model.UsersFilter) ([]models.UserRole, error) {
+	visible, ok := models.ListableRoles(requester.Role)
+	if !ok {
+		return nil, fmt.Errorf("access denied: insufficient permissions to view users list")
+	}
+	if filter == nil || len(filter.Roles) == 0 {
+		return visible, nil
+	}
+
+	roles := []models.UserRole{}
+	for _, role := range filter.Roles {
+		if visible == nil || slices.Contains(visible, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// authorizeUserCreation — общие проверки для createUser и inviteUser: роль существует
+// и не выше роли того, кто создаёт пользователя
+func (r *Resolver) authorizeUserCreation(ctx context.Context, role models.UserRole) (*models.User, error) {
+	if !role.IsValid() {
+		return nil, fmt.Errorf("invalid user role: %s", role)
+	}
+
+	requester, _, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !requester.HasEqualOrHigherRole(role) {
+		log.Printf("authorizeUserCreation: User %s (role %s) attempted to create user with role %s - forbidden by role hierarchy",
+			requester.ID.Hex(), requester.Role, role)
+		return nil, fmt.Errorf("insufficient permissions to create user with role %s", role)
+	}
+
+	return requester, nil
+}
+
+// assignUserToBuilding привязывает старост, кураторов и председателей к маркеру их корпуса
+func (r *Resolver) assignUserToBuilding(ctx context.Context, user *models.User) error {
+	if !(user.Role == models.UserRoleStarosta || user.Role == models.UserRoleSupervisor || user.Role == models.UserRolePredsedatel) ||
+		user.Building == nil || *user.Building == "" {
+		return nil
+	}
+
+	if user.ID.IsZero() {
+		log.Printf("assignUserToBuilding: Warning - User ID is zero after creation, skipping auto-assignment for user login '%s'", user.Login)
+		return nil
+	}
+
+	log.Printf("assignUserToBuilding: Attempting to auto-assign user %s to marker for building '%s'", user.ID.Hex(), *user.Building)
+
+	marker, err := r.MarkerService.GetMarkerByLabel(ctx, *user.Building)
+	if err != nil {
+		log.Printf("assignUserToBuilding: Warning - Could not find marker for building '%s': %v", *user.Building, err)
+		return nil
+	}
+
+	if err := r.MarkerService.AssignUserToMarker(ctx, user.ID, marker.ID); err != nil {
+		log.Printf("assignUserToBuilding: Failed to assign user %s to marker %s: %v", user.ID.Hex(), marker.ID.Hex(), err)
+		return fmt.Errorf("could not assign user to building '%s'", *user.Building)
+	}
+	log.Printf("assignUserToBuilding: Successfully assigned user %s to marker %s for building '%s'", user.ID.Hex(), marker.ID.Hex(), *user.Building)
+	return nil
+}
+
+// profileUpdate проверяет и нормализует поля, общие для updateUser и updateMyProfile.
+// nil означает «не менять».
+func profileUpdate(fullName, phoneNumber, telegramTag *string) (bson.M, error) {
+	set := bson.M{}
+
+	if fullName != nil {
+		normalized, err := models.NormalizeFullName(*fullName)
+		if err != nil {
+			return nil, err
+		}
+		set["full_name"] = normalized
+	}
+	if phoneNumber != nil {
+		normalized, err := models.NormalizePhoneNumber(*phoneNumber)
+		if err != nil {
+			return nil, err
+		}
+		set["phone_number"] = normalized
+	}
+	if telegramTag != nil {
+		normalized, err := models.NormalizeTelegramTag(*telegramTag)
+		if err != nil {
+			return nil, err
+		}
+		set["telegram_tag"] = normalized
+	}
+
+	return set, nil
+}
+
+// checkTelegramTag убирает из set тег, который не меняется, и отклоняет тег, уже указанный у другого пользователя
+func (r *Resolver) checkTelegramTag(ctx context.Context, user *models.User, set bson.M) error {
+	tag, ok := set["telegram_tag"].(string)
+	if !ok {
+		return nil
+	}
+	if tag == user.TelegramTag {
+		delete(set, "telegram_tag")
+		return nil
+	}
+
+	return r.ensureTelegramTagFree(ctx, tag, user.ID)
+}
+
+// ensureTelegramTagFree не даёт завести тег, уже указанный у другого пользователя: по тегу linkMyTelegram
+// сверяет аккаунт Telegram, и с дубликатами привязка стала бы неоднозначной
+func (r *Resolver) ensureTelegramTagFree(ctx context.Context, tag string, exceptID primitive.ObjectID) error {
+	taken, err := r.UserService.TelegramTagTaken(ctx, tag, exceptID)
+	if err != nil {
+		log.Printf("ensureTelegramTagFree: Failed to check tag %s: %v", tag, err)
+		return fmt.Errorf("could not validate telegram tag")
+	}
+	if taken {
+		return fmt.Errorf("telegram tag %s is already used by another user", tag)
+	}
+	return nil
+}
+
+// detachUserFromBuilding снимает пользователя с маркера его текущего корпуса перед сменой корпуса
+func (r *Resolver) detachUserFromBuilding(ctx context.Context, user *models.User) {
+	if user.Building == nil || *user.Building == "" {
+		return
+	}
+
+	marker, err := r.MarkerService.GetMarkerByLabel(ctx, *user.Building)
+	if err != nil {
+		log.Printf("detachUserFromBuilding: No marker for building '%s': %v", *user.Building, err)
+		return
+	}
+
+	if err := r.MarkerService.RemoveUserFromMarker(ctx, user.ID, marker.ID); err != nil {
+		log.Printf("detachUserFromBuilding: Failed to remove user %s from marker %s: %v", user.ID.Hex(), marker.ID.Hex(), err)
+	}
+}
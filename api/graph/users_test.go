@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/DGISsoft/DGISback/api/graph/model"
+	"github.com/DGISsoft/DGISback/models"
+)
+
+func TestUserListRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    models.UserRole
+		filter  *model.UsersFilter
+		want    []models.UserRole
+		wantErr bool
+	}{
+		{"dgis without filter", models.UserRoleDgis, nil, nil, false},
+		{"dgis with filter", models.UserRoleDgis, &model.UsersFilter{Roles: []models.UserRole{models.UserRolePredsedatel}},
+			[]models.UserRole{models.UserRolePredsedatel}, false},
+		{"predsedatel without filter", models.UserRolePredsedatel, &model.UsersFilter{},
+			[]models.UserRole{models.UserRoleStarosta, models.UserRoleSupervisor}, false},
+		{"predsedatel filter is intersected", models.UserRolePredsedatel,
+			&model.UsersFilter{Roles: []models.UserRole{models.UserRoleDgis, models.UserRoleStarosta}},
+			[]models.UserRole{models.UserRoleStarosta}, false},
+		{"predsedatel filter without visible roles", models.UserRolePredsedatel,
+			&model.UsersFilter{Roles: []models.UserRole{models.UserRoleDgis}}, []models.UserRole{}, false},
+		{"starosta", models.UserRoleStarosta, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := userListRoles(&models.User{Role: tt.role}, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("roles = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
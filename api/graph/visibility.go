@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// viewer — данные смотрящего, загружаются один раз на операцию
+type viewer struct {
+	once sync.Once
+	user *models.User
+	role models.UserRole
+}
+
+type viewerContextKey struct{}
+
+// ViewerCache кладёт в контекст операции пустой кеш смотрящего, который заполняется при первой проверке видимости
+func ViewerCache(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	return next(context.WithValue(ctx, viewerContextKey{}, &viewer{}))
+}
+
+func (r *Resolver) viewer(ctx context.Context) *viewer {
+	v, ok := ctx.Value(viewerContextKey{}).(*viewer)
+	if !ok {
+		v = &viewer{}
+	}
+
+	v.once.Do(func() {
+		userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+		if !isAuthenticated {
+			return
+		}
+		// Для API-ключа действует роль ключа, а не текущая роль владельца
+		v.role = userClaims.Role
+
+		userID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+		if err != nil {
+			return
+		}
+		user, err := r.UserService.GetUserByID(ctx, userID)
+		if err != nil {
+			log.Printf("viewer: Failed to load viewer %s: %v", userClaims.UserID, err)
+			return
+		}
+		v.user = user
+	})
+	return v
+}
+
+// canViewUserField применяет к полю пользователя subject правила видимости из models
+func (r *Resolver) canViewUserField(ctx context.Context, subject *models.User, field models.UserField) bool {
+	v := r.viewer(ctx)
+	return v.user.RelationTo(v.role, subject).CanView(field)
+}
+
+func (r *Resolver) visibleString(ctx context.Context, subject *models.User, field models.UserField, value string) *string {
+	if !r.canViewUserField(ctx, subject, field) {
+		return nil
+	}
+	return &value
+}
+
+func (r *Resolver) visibleBool(ctx context.Context, subject *models.User, field models.UserField, value bool) *bool {
+	if !r.canViewUserField(ctx, subject, field) {
+		return nil
+	}
+	return &value
+}
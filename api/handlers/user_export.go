@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DGISsoft/DGISback/api/formats"
+	"github.com/DGISsoft/DGISback/middleware"
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	noBuildingGroup     = "Без корпуса"
+	hiddenBuildingGroup = "Корпус скрыт"
+)
+
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"vcf":  "text/vcard; charset=utf-8",
+}
+
+type exportContact struct {
+	group       string
+	user        *models.User
+	phone       string
+	telegramTag string
+}
+
+// UserExport отдаёт контакты пользователей, сгруппированные по корпусам, в CSV, XLSX или vCard
+// (GET ?format=csv|xlsx|vcf). Видимость та же, что у запроса users; каждая выгрузка пишется в журнал аудита.
+func UserExport(users *mongo.UserService, markers *mongo.MarkerService, audit *mongo.AuditService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		contentType, ok := exportContentTypes[format]
+		if !ok {
+			http.Error(w, "unsupported format: expected csv, xlsx or vcf", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		userClaims, isAuthenticated := middleware.GetUserFromContext(ctx)
+		if !isAuthenticated {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Те же ограничения, что у корневых полей GraphQL: смена пароля, подключение 2FA и scope ключа
+		if err := middleware.CheckAccess(userClaims, "exportUsers", models.APIKeyScopeUsersRead); err != nil {
+			http.Error(w, err.Message, http.StatusForbidden)
+			return
+		}
+
+		requesterID, err := primitive.ObjectIDFromHex(userClaims.UserID)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		requester, err := users.GetUserByID(ctx, requesterID)
+		if err != nil {
+			log.Printf("UserExport: Failed to get requester %s: %v", userClaims.UserID, err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		roles, ok := models.ListableRoles(requester.Role)
+		if !ok {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		// В контакты попадают только действующие пользователи; limit 0 — без ограничения
+		list, err := users.FindUsers(ctx, mongo.UserFilter{Roles: roles, Statuses: []models.UserStatus{models.UserStatusActive}}, mongo.UserOrder{Field: mongo.UserOrderByFullName}, nil, 0)
+		if err != nil {
+			log.Printf("UserExport: Failed to load users: %v", err)
+			http.Error(w, "could not load users", http.StatusInternalServerError)
+			return
+		}
+		allMarkers, err := markers.GetAllMarkers(ctx)
+		if err != nil {
+			log.Printf("UserExport: Failed to load markers: %v", err)
+			http.Error(w, "could not load markers", http.StatusInternalServerError)
+			return
+		}
+
+		contacts := groupContacts(requester, userClaims.Role, list, allMarkers)
+
+		var body bytes.Buffer
+		switch format {
+		case "csv":
+			err = formats.WriteCSV(&body, exportHeader, exportRows(contacts))
+		case "xlsx":
+			err = formats.WriteXLSX(&body, "Контакты", exportHeader, exportRows(contacts))
+		case "vcf":
+			err = formats.WriteVCards(&body, exportVCards(contacts))
+		}
+		if err != nil {
+			log.Printf("UserExport: Failed to render %s: %v", format, err)
+			http.Error(w, "could not render export", http.StatusInternalServerError)
+			return
+		}
+
+		// Без записи в журнал персональные данные не отдаём
+		targetIDs := make([]primitive.ObjectID, 0, len(list))
+		for _, user := range list {
+			targetIDs = append(targetIDs, user.ID)
+		}
+		entry := middleware.NewAuditEntry(ctx, models.AuditActionUserExport,
+			fmt.Sprintf("выгрузка контактов (%s): %d пользователей", format, len(list)), targetIDs)
+		entry.After = map[string]any{"format": format, "count": len(list)}
+		if err := audit.Record(ctx, entry); err != nil {
+			log.Printf("UserExport: CRITICAL - Failed to record export by %s: %v", userClaims.Login, err)
+			http.Error(w, "could not record export", http.StatusInternalServerError)
+			return
+		}
+
+		filename := fmt.Sprintf("contacts-%s.%s", time.Now().Format("2006-01-02"), format)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Header().Set("Cache-Control", "no-store")
+		if _, err := w.Write(body.Bytes()); err != nil {
+			log.Printf("UserExport: Failed to write response: %v", err)
+		}
+	})
+}
+
+var exportHeader = []string{"Корпус", "ФИО", "Роль", "Телефон", "Telegram"}
+
+// groupContacts раскладывает пользователей по подписям их маркеров с учётом видимости полей;
+// пользователь с несколькими маркерами попадает в каждую группу
+func groupContacts(viewer *models.User, viewerRole models.UserRole, users []*models.User, markers []*models.Marker) []exportContact {
+	labels := make(map[primitive.ObjectID]string, len(markers))
+	for _, marker := range markers {
+		labels[marker.ID] = marker.Label
+	}
+
+	var contacts []exportContact
+	for _, user := range users {
+		relation := viewer.RelationTo(viewerRole, user)
+		contact := exportContact{user: user}
+		if relation.CanView(models.UserFieldPhoneNumber) {
+			contact.phone = user.PhoneNumber
+		}
+		if relation.CanView(models.UserFieldTelegramTag) {
+			contact.telegramTag = user.TelegramTag
+		}
+
+		groups := []string{hiddenBuildingGroup}
+		if relation.CanView(models.UserFieldBuilding) {
+			groups = nil
+			for _, markerID := range user.Markers {
+				if label, ok := labels[markerID]; ok {
+					groups = append(groups, label)
+				}
+			}
+			if len(groups) == 0 {
+				groups = []string{noBuildingGroup}
+			}
+		}
+
+		for _, group := range groups {
+			contact.group = group
+			contacts = append(contacts, contact)
+		}
+	}
+
+	// Пользователи уже отсортированы по ФИО; стабильная сортировка сохраняет этот порядок внутри корпуса
+	sort.SliceStable(contacts, func(i, j int) bool {
+		ri, rj := groupRank(contacts[i].group), groupRank(contacts[j].group)
+		if ri != rj {
+			return ri < rj
+		}
+		return contacts[i].group < contacts[j].group
+	})
+	return contacts
+}
+
+// groupRank ставит группы без корпуса в конец списка
+func groupRank(group string) int {
+	switch group {
+	case noBuildingGroup:
+		return 1
+	case hiddenBuildingGroup:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func exportRows(contacts []exportContact) [][]string {
+	rows := make([][]string, 0, len(contacts))
+	for _, contact := range contacts {
+		rows = append(rows, []string{contact.group, contact.user.FullName, string(contact.user.Role), contact.phone, contact.telegramTag})
+	}
+	return rows
+}
+
+// exportVCards выдаёт одну карточку на пользователя; все его корпуса перечисляются в ORG
+func exportVCards(contacts []exportContact) []formats.VCard {
+	var cards []formats.VCard
+	index := map[primitive.ObjectID]int{}
+	for _, contact := range contacts {
+		if i, ok := index[contact.user.ID]; ok {
+			cards[i].Organization += ", " + contact.group
+			continue
+		}
+		index[contact.user.ID] = len(cards)
+		cards = append(cards, formats.VCard{
+			FullName:     contact.user.FullName,
+			Organization: contact.group,
+			Title:        strings.ToLower(string(contact.user.Role)),
+			Phone:        contact.phone,
+			TelegramTag:  contact.telegramTag,
+		})
+	}
+	return cards
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -12,10 +13,15 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler/lru"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/DGISsoft/DGISback/api/auth"
 	"github.com/DGISsoft/DGISback/api/graph"
+	"github.com/DGISsoft/DGISback/api/handlers"
+	"github.com/DGISsoft/DGISback/env"
 	"github.com/DGISsoft/DGISback/middleware"
 	"github.com/DGISsoft/DGISback/models"
 	serv "github.com/DGISsoft/DGISback/services/mongo"
+	red "github.com/DGISsoft/DGISback/services/redis"
+	"github.com/gorilla/websocket"
 	"github.com/rs/cors"
 	"github.com/vektah/gqlparser/v2/ast"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -24,13 +30,66 @@ import (
 
 const defaultPort = "8080"
 
+var allowedOrigins = []string{"http://localhost:5173"}
+
+func isAllowedOrigin(origin string) bool {
+    for _, allowed := range allowedOrigins {
+        if origin == allowed {
+            return true
+        }
+    }
+    return false
+}
+
+
+const defaultAdminLogin = "admin"
+
+func getEnvDuration(name string, defaultValue time.Duration) time.Duration {
+    if value := env.GetEnv(name, ""); value != "" {
+        if d, err := time.ParseDuration(value); err == nil {
+            return d
+        }
+        log.Printf("Warning: Invalid duration in %s=%q, using %s", name, value, defaultValue)
+    }
+    return defaultValue
+}
 
 const (
-    defaultAdminLogin    = "admin"
-    defaultAdminPassword = "admin"
+    userPurgeInterval = time.Hour
+    userPurgeLeaseKey = "user_purge:lease"
 )
 
-func createDefaultAdmin(userService *serv.UserService) {
+// runUserPurge раз в час окончательно удаляет пользователей, пробывших удалёнными дольше retention.
+// Запускается на каждой реплике, но за интервал очистку выполняет только та, что первой взяла аренду в Redis.
+func runUserPurge(resolver *graph.Resolver, redisService *red.RedisService, retention time.Duration) {
+    ticker := time.NewTicker(userPurgeInterval)
+    defer ticker.Stop()
+
+    for {
+        // Аренда чуть короче интервала, чтобы та же реплика успела взять её на следующем тике
+        acquired, err := redisService.SetValueIfAbsent(userPurgeLeaseKey, time.Now().Unix(), userPurgeInterval-time.Minute)
+        if err != nil {
+            log.Printf("runUserPurge: Failed to acquire lease: %v", err)
+        }
+        if !acquired {
+            <-ticker.C
+            continue
+        }
+
+        purged, err := resolver.PurgeDeletedUsers(context.Background(), retention)
+        if err != nil {
+            log.Printf("runUserPurge: Failed to purge deleted users: %v", err)
+        } else if purged > 0 {
+            log.Printf("runUserPurge: Purged %d users deleted more than %s ago", purged, retention)
+        }
+        <-ticker.C
+    }
+}
+
+// createDefaultAdmin создаёт первого администратора в пустой базе. Учётные данные берутся из
+// BOOTSTRAP_ADMIN_*; если пароль не задан, генерируется одноразовый и выводится в лог один раз.
+// В любом случае при первом входе администратор обязан сменить пароль.
+func createDefaultAdmin(userService *serv.UserService, passwordPolicy *auth.PasswordPolicy) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
@@ -48,15 +107,27 @@ func createDefaultAdmin(userService *serv.UserService) {
 
     log.Println("No users found. Creating default admin user...")
 
+    login := env.GetEnv("BOOTSTRAP_ADMIN_LOGIN", defaultAdminLogin)
+    password := env.GetEnv("BOOTSTRAP_ADMIN_PASSWORD", "")
+    generated := password == ""
+    if generated {
+        password, err = passwordPolicy.GenerateTemporaryPassword()
+        if err != nil {
+            log.Printf("Error: Failed to generate default admin password: %v", err)
+            return
+        }
+    }
+
     adminUser := &models.User{
-        Login:       defaultAdminLogin,
-        Password:    defaultAdminPassword,
-        Role:        models.UserRolePredsedatel,
-        FullName:    "Default Administrator",
-        PhoneNumber: "+00000000000",
-        TelegramTag: "@admin",
-        CreatedAt:   time.Now(),
-        UpdatedAt:   time.Now(),
+        Login:              login,
+        Password:           password,
+        Role:               models.UserRolePredsedatel,
+        FullName:           env.GetEnv("BOOTSTRAP_ADMIN_FULL_NAME", "Default Administrator"),
+        PhoneNumber:        env.GetEnv("BOOTSTRAP_ADMIN_PHONE", ""),
+        TelegramTag:        env.GetEnv("BOOTSTRAP_ADMIN_TELEGRAM", ""),
+        MustChangePassword: true,
+        CreatedAt:          time.Now(),
+        UpdatedAt:          time.Now(),
     }
 
     if err := userService.CreateUser(ctx, adminUser); err != nil {
@@ -64,11 +135,25 @@ func createDefaultAdmin(userService *serv.UserService) {
         return
     }
 
-    log.Printf("Default admin user '%s' created successfully!", defaultAdminLogin)
+    if generated {
+        log.Printf("Default admin user '%s' created with one-time password: %s", login, password)
+        log.Println("This password is shown only once and must be changed on first login.")
+    } else {
+        log.Printf("Default admin user '%s' created from BOOTSTRAP_ADMIN_PASSWORD, password change required on first login", login)
+    }
 }
 
 func main() {
-    client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI("mongodb://localhost:27017")) // Ваш URI
+    keySet, err := auth.LoadKeySet()
+    if err != nil {
+        log.Fatalf("Failed to load JWT signing keys: %v", err)
+    }
+    jwtManager := auth.NewJWTManager(keySet, auth.GetTokenDuration())
+
+    // Изменения связей маркеров и пользователей выполняются в транзакциях, поэтому MongoDB должна
+    // быть replica set (хотя бы из одного узла), например mongodb://localhost:27017/?replicaSet=rs0
+    mongoURI := env.GetEnv("MONGO_URI", "mongodb://localhost:27017")
+    client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
     if err != nil {
         log.Fatal(err)
     }
@@ -80,36 +165,119 @@ func main() {
 
     database := client.Database("dgis-db")
 
+    redisClient := red.NewRedisClient(
+        env.GetEnv("REDIS_HOST", "localhost:6379"),
+        env.GetEnv("REDIS_PASSWORD", ""),
+        env.GetEnv("REDIS_DB", 0),
+    )
+    redisService := red.NewRedisService(redisClient)
+
     mongoService := serv.New(database)
+    // Только для локальной разработки на MongoDB без replica set
+    mongoService.AllowNonTransactional(env.GetEnv("MONGO_ALLOW_NON_TRANSACTIONAL", false))
+    transactionsCtx, cancelTransactions := context.WithTimeout(context.Background(), 10*time.Second)
+    if err := mongoService.CheckTransactions(transactionsCtx); err != nil {
+        if errors.Is(err, serv.ErrTransactionsUnsupported) {
+            log.Fatal("MongoDB does not support transactions: run it as a replica set (mongod --replSet rs0, then rs.initiate()) " +
+                "and add replicaSet to MONGO_URI, or set MONGO_ALLOW_NON_TRANSACTIONAL=true for local development only")
+        }
+        log.Fatalf("Failed to check MongoDB transaction support: %v", err)
+    }
+    cancelTransactions()
     userService := serv.NewUserService(mongoService)
     markerService := serv.NewMarkerService(mongoService)
-    notificationService := serv.NewNotificationService(mongoService)
+    notificationService := serv.NewNotificationService(mongoService, redisService)
+    apiKeyService := serv.NewAPIKeyService(mongoService)
+    inviteService := serv.NewInviteService(mongoService)
+    auditService := serv.NewAuditService(mongoService)
+    sessionService := red.NewSessionService(redisService)
+    twoFactorService := red.NewTwoFactorService(redisService)
+    loginThrottle := red.NewLoginThrottle(redisService, red.LoginThrottleConfig{
+        MaxAttemptsPerLogin: int64(env.GetEnv("LOGIN_MAX_ATTEMPTS", 5)),
+        MaxAttemptsPerIP:    int64(env.GetEnv("LOGIN_IP_MAX_ATTEMPTS", 30)),
+        Window:              getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+        BaseLockout:         getEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+        MaxLockout:          getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+    })
 
 
-    createDefaultAdmin(userService)
+    indexCtx, cancelIndexes := context.WithTimeout(context.Background(), 10*time.Second)
+    if err := markerService.EnsureMarkerIndexes(indexCtx); err != nil {
+        log.Printf("Warning: %v (duplicate markerId or label in markers?)", err)
+    }
+    if err := userService.EnsureUserIndexes(indexCtx); err != nil {
+        log.Printf("Warning: %v (duplicate login or one telegram account linked to several users?)", err)
+    }
+    if err := apiKeyService.EnsureAPIKeyIndexes(indexCtx); err != nil {
+        log.Printf("Warning: %v", err)
+    }
+    cancelIndexes()
+
+    passwordPolicy := auth.GetPasswordPolicy()
+    createDefaultAdmin(userService, passwordPolicy)
 
 
     resolver := &graph.Resolver{
         UserService: userService,
         MarkerService: markerService,
         NotificationService: notificationService,
+        APIKeyService: apiKeyService,
+        InviteService: inviteService,
+        AuditService: auditService,
+        UserCascade: serv.NewUserCascade(mongoService),
+        SessionService: sessionService,
+        LoginThrottle: loginThrottle,
+        TwoFactorService: twoFactorService,
+        PasswordPolicy: passwordPolicy,
+        TwoFactorPolicy: auth.GetTwoFactorPolicy(),
+        TelegramVerifier: auth.GetTelegramVerifier(),
+        JWTManager: jwtManager,
     }
+    go runUserPurge(resolver, redisService, getEnvDuration("USER_PURGE_AFTER", 30*24*time.Hour))
     port := os.Getenv("PORT")
     if port == "" {
         port = defaultPort
     }
 
     c := cors.New(cors.Options{
-        AllowedOrigins: []string{"http://localhost:5173"},
+        AllowedOrigins: allowedOrigins,
         AllowCredentials: true,
         AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
         AllowedHeaders: []string{"*"},
+        ExposedHeaders: []string{middleware.RefreshRequiredHeader},
     })
-    srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+    srv := handler.New(graph.NewExecutableSchema(graph.Config{
+        Resolvers:  resolver,
+        Directives: graph.NewDirectiveRoot(),
+    }))
 
     srv.AddTransport(transport.Options{})
     srv.AddTransport(transport.GET{})
     srv.AddTransport(transport.POST{})
+    srv.AddTransport(transport.MultipartForm{
+        MaxUploadSize: 10 << 20,
+        MaxMemory:     10 << 20,
+    })
+    srv.AddTransport(transport.Websocket{
+        KeepAlivePingInterval: 10 * time.Second,
+        Upgrader: websocket.Upgrader{
+            CheckOrigin: func(r *http.Request) bool {
+                return isAllowedOrigin(r.Header.Get("Origin"))
+            },
+        },
+        InitFunc: func(ctx context.Context, initPayload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+            if _, ok := middleware.GetUserFromContext(ctx); !ok {
+                return nil, nil, errors.New("unauthorized")
+            }
+            return ctx, &initPayload, nil
+        },
+    })
+
+    srv.AroundFields(graph.ObjectDirectives)
+    srv.AroundRootFields(graph.PasswordChangeGuard)
+    srv.AroundRootFields(graph.TwoFactorSetupGuard)
+    srv.AroundRootFields(graph.APIKeyScopeGuard)
+    srv.AroundOperations(graph.ViewerCache)
 
     srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
 
@@ -119,7 +287,9 @@ func main() {
     })
     muxGraphql := http.NewServeMux()
 	muxGraphql.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	muxGraphql.Handle("/query", c.Handler(middleware.AuthMiddleware(srv)))
+	muxGraphql.Handle("/query", c.Handler(middleware.CSRFMiddleware(isAllowedOrigin)(middleware.AuthMiddleware(jwtManager, sessionService, apiKeyService)(srv))))
+	muxGraphql.Handle("/.well-known/jwks.json", handlers.JWKS(keySet))
+	muxGraphql.Handle("/export/users", c.Handler(middleware.AuthMiddleware(jwtManager, sessionService, apiKeyService)(handlers.UserExport(userService, markerService, auditService))))
 
     log.Printf("Starting GraphQL server on :%s", port)
     if err := http.ListenAndServe(":"+port, muxGraphql); err != nil {
@@ -4,17 +4,25 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
+// GetEnv возвращает значение переменной окружения, приведённое к типу defaultValue.
+// defaultValue возвращается, только если переменная не задана: без этого незаданные
+// числовые и булевы переменные (REDIS_DB, LOGIN_MAX_ATTEMPTS и т.п.) завершали процесс на разборе "".
+// Явно заданное пустое значение возвращается как есть.
 func GetEnv[T any](nameEnv string, defaultValue T) T {
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
 
-	valueStr := os.Getenv(nameEnv)
+	valueStr, ok := os.LookupEnv(nameEnv)
+	if !ok {
+		return defaultValue
+	}
 
 	var value any
 
@@ -45,4 +53,10 @@ func GetEnv[T any](nameEnv string, defaultValue T) T {
 	}
 
 	return value.(T)
-}
\ No newline at end of file
+}
+
+// IsDevelopment сообщает, что сервер явно запущен в режиме разработки (APP_ENV=development)
+func IsDevelopment() bool {
+	appEnv := strings.ToLower(GetEnv("APP_ENV", ""))
+	return appEnv == "development" || appEnv == "dev"
+}
@@ -0,0 +1,34 @@
+package env
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGetEnv(t *testing.T) {
+	// GetEnv требует файл .env в рабочем каталоге
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(".env", nil, 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+
+	t.Setenv("TEST_ENV_INT", "7")
+	t.Setenv("TEST_ENV_BOOL", "true")
+	t.Setenv("TEST_ENV_EMPTY", "")
+
+	if got := GetEnv("TEST_ENV_INT", 5); got != 7 {
+		t.Errorf("set int = %d, want 7", got)
+	}
+	if got := GetEnv("TEST_ENV_BOOL", false); !got {
+		t.Errorf("set bool = %v, want true", got)
+	}
+	if got := GetEnv("TEST_ENV_UNSET", 5); got != 5 {
+		t.Errorf("unset int = %d, want default 5", got)
+	}
+	if got := GetEnv("TEST_ENV_UNSET", "default"); got != "default" {
+		t.Errorf("unset string = %q, want default", got)
+	}
+	if got := GetEnv("TEST_ENV_EMPTY", "default"); got != "" {
+		t.Errorf("empty string = %q, want empty value", got)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/models"
+)
+
+// AccessError — отказ в доступе к операции; Code уходит клиенту в extensions.code
+type AccessError struct {
+	Code    string
+	Message string
+}
+
+func (e *AccessError) Error() string {
+	return e.Message
+}
+
+// CheckPasswordChange не пускает пользователя с флагом mustChangePassword дальше смены пароля
+func CheckPasswordChange(claims *auth.JWTClaims, operation string) *AccessError {
+	if !claims.MustChangePassword || PasswordChangeAllowedFields[operation] {
+		return nil
+	}
+	return &AccessError{Code: "PASSWORD_CHANGE_REQUIRED", Message: fmt.Sprintf("password change required before accessing %s", operation)}
+}
+
+// CheckTwoFactorSetup оставляет пользователю, обязанному подключить 2FA, только подключение
+func CheckTwoFactorSetup(claims *auth.JWTClaims, operation string) *AccessError {
+	if !claims.TwoFactorSetupRequired || TwoFactorSetupAllowedFields[operation] {
+		return nil
+	}
+	return &AccessError{Code: "TWO_FACTOR_SETUP_REQUIRED", Message: fmt.Sprintf("two-factor setup required before accessing %s", operation)}
+}
+
+// CheckAPIKeyScope пускает API-ключ к операции, только если ему выдан scope; пустой scope — операция ключам закрыта.
+// Пользователей с токеном не затрагивает.
+func CheckAPIKeyScope(claims *auth.JWTClaims, operation string, scope models.APIKeyScope) *AccessError {
+	if !claims.IsAPIKey() || (scope != "" && claims.HasScope(scope)) {
+		return nil
+	}
+	return &AccessError{Code: "FORBIDDEN", Message: fmt.Sprintf("api key is not allowed to access %s", operation)}
+}
+
+// CheckAccess применяет к операции вне GraphQL те же проверки, что и guards корневых полей
+func CheckAccess(claims *auth.JWTClaims, operation string, scope models.APIKeyScope) *AccessError {
+	if err := CheckPasswordChange(claims, operation); err != nil {
+		return err
+	}
+	if err := CheckTwoFactorSetup(claims, operation); err != nil {
+		return err
+	}
+	return CheckAPIKeyScope(claims, operation, scope)
+}
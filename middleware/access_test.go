@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/models"
+)
+
+func TestCheckAccess(t *testing.T) {
+	apiKey := &auth.JWTClaims{APIKeyID: "key", Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead}}
+
+	tests := []struct {
+		name      string
+		claims    *auth.JWTClaims
+		operation string
+		scope     models.APIKeyScope
+		code      string
+	}{
+		{"user", &auth.JWTClaims{}, "users", "", ""},
+		{"password change required", &auth.JWTClaims{MustChangePassword: true}, "users", "", "PASSWORD_CHANGE_REQUIRED"},
+		{"password change allowed field", &auth.JWTClaims{MustChangePassword: true}, "changeMyPassword", "", ""},
+		{"two-factor setup required", &auth.JWTClaims{TwoFactorSetupRequired: true}, "exportUsers", models.APIKeyScopeUsersRead, "TWO_FACTOR_SETUP_REQUIRED"},
+		{"two-factor setup allowed field", &auth.JWTClaims{TwoFactorSetupRequired: true}, "beginTwoFactorEnrollment", "", ""},
+		{"api key with scope", apiKey, "exportUsers", models.APIKeyScopeUsersRead, ""},
+		{"api key without scope", apiKey, "dashboard", models.APIKeyScopeDashboardRead, "FORBIDDEN"},
+		{"api key on field without scope", apiKey, "createUser", "", "FORBIDDEN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckAccess(tt.claims, tt.operation, tt.scope)
+			code := ""
+			if err != nil {
+				code = err.Code
+			}
+			if code != tt.code {
+				t.Errorf("CheckAccess(%s) = %v, want code %q", tt.operation, err, tt.code)
+			}
+		})
+	}
+}
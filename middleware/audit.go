@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/DGISsoft/DGISback/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewAuditEntry создаёт запись журнала аудита с автором, IP и User-Agent текущего запроса
+func NewAuditEntry(ctx context.Context, action models.AuditAction, summary string, targetIDs []primitive.ObjectID) *models.AuditEntry {
+	entry := &models.AuditEntry{
+		Action:    action,
+		TargetIDs: targetIDs,
+		Summary:   summary,
+		IP:        GetClientIPFromContext(ctx),
+		UserAgent: GetUserAgentFromContext(ctx),
+	}
+
+	if userClaims, ok := GetUserFromContext(ctx); ok {
+		entry.ActorID, _ = primitive.ObjectIDFromHex(userClaims.UserID)
+		entry.ActorLogin = userClaims.Login
+		entry.ActorRole = userClaims.Role
+		entry.APIKeyID = userClaims.APIKeyID
+	}
+
+	return entry
+}
@@ -3,12 +3,16 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/DGISsoft/DGISback/api/auth"
+	"github.com/DGISsoft/DGISback/services/mongo"
+	"github.com/DGISsoft/DGISback/services/redis"
 )
 
 
@@ -16,10 +20,52 @@ type contextKey struct {
 	name string
 }
 
-const AuthCookieName = "auth-token"
+const (
+	AuthCookieName    = "auth-token"
+	RefreshCookieName = "refresh-token"
+
+	// Заголовок, по которому клиент понимает, что пора вызвать refreshToken
+	RefreshRequiredHeader = "X-Auth-Refresh-Required"
+)
+
+// Корневые поля GraphQL, доступные пользователю, который обязан сменить пароль
+var PasswordChangeAllowedFields = map[string]bool{
+	"me":                true,
+	"changeMyPassword":  true,
+	"login":             true,
+	"loginWithTelegram": true,
+	"verifyTwoFactor":   true,
+	"logout":            true,
+	"refreshToken":      true,
+	"__typename":        true,
+	"__schema":          true,
+	"__type":            true,
+}
+
+// Корневые поля GraphQL, доступные пользователю, который обязан подключить 2FA
+var TwoFactorSetupAllowedFields = map[string]bool{
+	"me":                         true,
+	"beginTwoFactorEnrollment":   true,
+	"confirmTwoFactorEnrollment": true,
+	"changeMyPassword":           true,
+	"login":                      true,
+	"loginWithTelegram":          true,
+	"verifyTwoFactor":            true,
+	"logout":                     true,
+	"refreshToken":               true,
+	"__typename":                 true,
+	"__schema":                   true,
+	"__type":                     true,
+}
+
+// Доля времени жизни access-токена, после которой клиенту предлагается его обновить
+const refreshThreshold = 0.2
 
 type AuthContext struct {
-	User *auth.JWTClaims 
+	User         *auth.JWTClaims
+	ClientIP     string
+	UserAgent    string
+	RefreshToken string
 }
 
 var (
@@ -38,6 +84,27 @@ func GetUserFromContext(ctx context.Context) (*auth.JWTClaims, bool) {
 	return nil, false
 }
 
+func GetClientIPFromContext(ctx context.Context) string {
+	if ac, ok := ctx.Value(authContextKey).(*AuthContext); ok {
+		return ac.ClientIP
+	}
+	return ""
+}
+
+func GetUserAgentFromContext(ctx context.Context) string {
+	if ac, ok := ctx.Value(authContextKey).(*AuthContext); ok {
+		return ac.UserAgent
+	}
+	return ""
+}
+
+func GetRefreshTokenFromContext(ctx context.Context) string {
+	if ac, ok := ctx.Value(authContextKey).(*AuthContext); ok {
+		return ac.RefreshToken
+	}
+	return ""
+}
+
 func GetResponseWriterFromContext(ctx context.Context) (http.ResponseWriter, error) {
 	if w, ok := ctx.Value(responseWriterKey).(*AuthResponseWriterWrapper); ok {
 		return w.ResponseWriter, nil
@@ -48,67 +115,154 @@ func GetResponseWriterFromContext(ctx context.Context) (http.ResponseWriter, err
 	return nil, fmt.Errorf("http.ResponseWriter not found in context")
 }
 
+// Cookie живёт столько же, сколько refresh-токен: так истёкший access-токен
+// доходит до сервера и клиент получает сигнал RefreshRequiredHeader
 func SignalSetAuthCookieDirect(w http.ResponseWriter, tokenString string) {
-	tokenDuration := auth.GetTokenDuration()
+	tokenDuration := auth.GetRefreshTokenDuration()
 	http.SetCookie(w, &http.Cookie{
 		Name:     AuthCookieName,
 		Value:    tokenString,
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
+		Secure:   cookieSettings().Secure,
+		SameSite: cookieSettings().SameSite,
 		MaxAge:   int(tokenDuration.Seconds()),
 	})
 	log.Printf("Auth: Set cookie, token length: %d", len(tokenString))
 }
 
-func SignalClearAuthCookieDirect(w http.ResponseWriter) {
+func SignalSetRefreshCookieDirect(w http.ResponseWriter, refreshToken string) {
+	tokenDuration := auth.GetRefreshTokenDuration()
 	http.SetCookie(w, &http.Cookie{
-		Name:     AuthCookieName,
-		Value:    "",
+		Name:     RefreshCookieName,
+		Value:    refreshToken,
 		Path:     "/",
 		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   -1,
-		Expires:  time.Unix(0, 0),
+		Secure:   cookieSettings().Secure,
+		SameSite: cookieSettings().SameSite,
+		MaxAge:   int(tokenDuration.Seconds()),
 	})
+	log.Printf("Auth: Set refresh cookie")
+}
+
+func SignalClearAuthCookieDirect(w http.ResponseWriter) {
+	for _, name := range []string{AuthCookieName, RefreshCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   cookieSettings().Secure,
+			SameSite: cookieSettings().SameSite,
+			MaxAge:   -1,
+			Expires:  time.Unix(0, 0),
+		})
+	}
 	log.Println("Auth: Cleared cookie")
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Auth: Processing %s %s", r.Method, r.URL.Path)
+func isWebsocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
 
-		authCtx := &AuthContext{}
+// bearerToken возвращает токен из заголовка "Authorization: Bearer <token>"
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
 
-		var tokenString string
-		if cookie, err := r.Cookie(AuthCookieName); err == nil {
-			tokenString = cookie.Value
-			log.Printf("Auth: Found cookie, length: %d", len(tokenString))
-		} else {
-			log.Printf("Auth: No cookie found: %v", err)
-		}
+func needsRefresh(claims *auth.JWTClaims) bool {
+	if claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return false
+	}
+	lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time)
+	return time.Until(claims.ExpiresAt.Time) < time.Duration(float64(lifetime)*refreshThreshold)
+}
+
+func AuthMiddleware(jwtManager *auth.JWTManager, sessions *redis.SessionService, apiKeys *mongo.APIKeyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log.Printf("Auth: Processing %s %s", r.Method, r.URL.Path)
 
-		if tokenString != "" {
-			jwtManager := auth.NewJWTManager(auth.GetSecretKey(), auth.GetTokenDuration())
-			if claims, err := jwtManager.VerifyToken(tokenString); err == nil {
-				log.Println("Auth: Token verified")
-				authCtx.User = claims
+			authCtx := &AuthContext{
+				ClientIP:  clientIP(r),
+				UserAgent: r.UserAgent(),
+			}
+
+			// Заголовок Authorization приоритетнее cookie: им пользуются бот и скрипты
+			tokenString := bearerToken(r)
+			if tokenString != "" {
+				log.Printf("Auth: Found bearer token, length: %d", len(tokenString))
+			} else if cookie, err := r.Cookie(AuthCookieName); err == nil {
+				tokenString = cookie.Value
+				log.Printf("Auth: Found cookie, length: %d", len(tokenString))
 			} else {
-				log.Printf("Auth: Invalid token: %v", err)
+				log.Printf("Auth: No cookie found: %v", err)
 			}
-		} else {
-			log.Println("Auth: No token to verify")
-		}
-
-		ctxWithAuth := context.WithValue(r.Context(), authContextKey, authCtx)
-		wrappedW := &AuthResponseWriterWrapper{ResponseWriter: w}
-		ctxWithEverything := context.WithValue(ctxWithAuth, responseWriterKey, wrappedW)
-		rWithAuth := r.WithContext(ctxWithEverything)
-
-		log.Println("Auth: Calling next handler")
-		next.ServeHTTP(w, rWithAuth)
-		log.Println("Auth: Handler finished")
-	})
-}
\ No newline at end of file
+
+			if cookie, err := r.Cookie(RefreshCookieName); err == nil {
+				authCtx.RefreshToken = cookie.Value
+			}
+
+			switch {
+			case tokenString == "":
+				log.Println("Auth: No token to verify")
+			case mongo.IsAPIKey(tokenString):
+				key, err := apiKeys.Authenticate(r.Context(), tokenString, authCtx.ClientIP)
+				if err != nil {
+					log.Printf("Auth: API key rejected: %v", err)
+					break
+				}
+				log.Printf("Auth: API key %s (%s) verified", key.ID.Hex(), key.Name)
+				authCtx.User = auth.NewAPIKeyClaims(key)
+			default:
+				claims, err := jwtManager.VerifyToken(tokenString)
+				switch {
+				case err == nil:
+					log.Println("Auth: Token verified")
+					if session, err := sessions.GetSession(claims.SessionID()); err == nil && session.UserID == claims.UserID {
+						sessions.TouchSession(session, authCtx.ClientIP)
+						authCtx.User = claims
+						if needsRefresh(claims) {
+							w.Header().Set(RefreshRequiredHeader, "true")
+						}
+					} else {
+						log.Printf("Auth: Session %q is revoked or unavailable: %v", claims.SessionID(), err)
+					}
+				case errors.Is(err, auth.ErrExpiredToken):
+					log.Println("Auth: Token expired, refresh required")
+					w.Header().Set(RefreshRequiredHeader, "true")
+				default:
+					log.Printf("Auth: Invalid token: %v", err)
+				}
+			}
+
+			// Подписки по websocket живут дольше запроса и не проходят через проверку полей,
+			// поэтому до смены пароля и подключения 2FA соединение не открываем
+			if authCtx.User != nil && isWebsocketUpgrade(r) {
+				if authCtx.User.MustChangePassword {
+					log.Printf("Auth: Rejected websocket for user %s, password change required", authCtx.User.UserID)
+					http.Error(w, "password change required", http.StatusForbidden)
+					return
+				}
+				if authCtx.User.TwoFactorSetupRequired {
+					log.Printf("Auth: Rejected websocket for user %s, two-factor setup required", authCtx.User.UserID)
+					http.Error(w, "two-factor setup required", http.StatusForbidden)
+					return
+				}
+			}
+
+			ctxWithAuth := context.WithValue(r.Context(), authContextKey, authCtx)
+			wrappedW := &AuthResponseWriterWrapper{ResponseWriter: w}
+			ctxWithEverything := context.WithValue(ctxWithAuth, responseWriterKey, wrappedW)
+			rWithAuth := r.WithContext(ctxWithEverything)
+
+			log.Println("Auth: Calling next handler")
+			next.ServeHTTP(w, rWithAuth)
+			log.Println("Auth: Handler finished")
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// middleware/client_ip.go
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxies     []netip.Prefix
+	trustedProxiesOnce sync.Once
+)
+
+// trustedProxyList читает TRUSTED_PROXIES (IP или CIDR через запятую) при первом обращении.
+// По умолчанию список пуст, и заголовки X-Forwarded-For / X-Real-IP игнорируются.
+// os.Getenv вместо env.GetEnv: .env уже загружен при старте сервера, а env.GetEnv без файла .env завершает процесс.
+func trustedProxyList() []netip.Prefix {
+	trustedProxiesOnce.Do(func() {
+		trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	})
+	return trustedProxies
+}
+
+func parseTrustedProxies(value string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		log.Printf("Auth: Ignoring invalid TRUSTED_PROXIES entry %q", item)
+	}
+	return prefixes
+}
+
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func clientIP(r *http.Request) string {
+	return clientIPWithProxies(r, trustedProxyList())
+}
+
+// clientIPWithProxies доверяет заголовкам прокси, только если запрос пришёл от доверенного прокси.
+// X-Forwarded-For разбирается справа налево: первый адрес не из списка прокси и есть клиент,
+// всё левее него мог подставить сам клиент.
+func clientIPWithProxies(r *http.Request, trusted []netip.Prefix) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrustedProxy(remote, trusted) {
+		return remote
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			if !isTrustedProxy(hop, trusted) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return remote
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPWithProxies(t *testing.T) {
+	trusted := parseTrustedProxies("10.0.0.0/8, 192.168.1.5, not-an-ip")
+	if len(trusted) != 2 {
+		t.Fatalf("parsed %d trusted proxies, want 2", len(trusted))
+	}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:5000", "1.2.3.4", "5.6.7.8", "203.0.113.7"},
+		{"single trusted proxy", "10.1.2.3:443", "198.51.100.20", "", "198.51.100.20"},
+		{"client-supplied prefix is skipped", "10.1.2.3:443", "1.2.3.4, 198.51.100.20", "", "198.51.100.20"},
+		{"chain of trusted proxies", "192.168.1.5:80", "198.51.100.20, 10.0.0.9", "", "198.51.100.20"},
+		{"real ip from trusted proxy", "192.168.1.5:80", "", "198.51.100.21", "198.51.100.21"},
+		{"garbage header falls back to proxy", "10.1.2.3:443", "garbage", "", "10.1.2.3"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/query", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := clientIPWithProxies(r, trusted); got != tc.want {
+				t.Errorf("clientIPWithProxies() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// middleware/cookies.go
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/DGISsoft/DGISback/env"
+)
+
+// CookieConfig — атрибуты auth-cookie для текущего окружения
+type CookieConfig struct {
+	Secure   bool
+	SameSite http.SameSite
+}
+
+var (
+	cookieConfig     CookieConfig
+	cookieConfigOnce sync.Once
+)
+
+// cookieSettings читает COOKIE_SECURE и COOKIE_SAMESITE (lax, strict, none) при первом обращении.
+// По умолчанию Secure включён везде, кроме APP_ENV=development.
+func cookieSettings() CookieConfig {
+	cookieConfigOnce.Do(func() {
+		cookieConfig = CookieConfig{
+			Secure:   env.GetEnv("COOKIE_SECURE", !env.IsDevelopment()),
+			SameSite: parseSameSite(env.GetEnv("COOKIE_SAMESITE", "lax")),
+		}
+		// Браузеры отбрасывают SameSite=None без Secure
+		if cookieConfig.SameSite == http.SameSiteNoneMode && !cookieConfig.Secure {
+			log.Println("Auth: COOKIE_SAMESITE=none requires Secure cookies, enabling Secure")
+			cookieConfig.Secure = true
+		}
+	})
+	return cookieConfig
+}
+
+func parseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "lax", "":
+		return http.SameSiteLaxMode
+	default:
+		log.Printf("Auth: Unknown COOKIE_SAMESITE %q, using lax", value)
+		return http.SameSiteLaxMode
+	}
+}
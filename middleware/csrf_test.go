@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testOrigin = "https://dgis.example"
+
+func csrfTestHandler() (http.Handler, *bool) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+	allowed := func(origin string) bool { return origin == testOrigin }
+	return CSRFMiddleware(allowed)(next), &called
+}
+
+func withAuthCookie(r *http.Request) *http.Request {
+	r.AddCookie(&http.Cookie{Name: AuthCookieName, Value: "token"})
+	return r
+}
+
+func getRequest(query, operationName string) *http.Request {
+	params := url.Values{"query": {query}}
+	if operationName != "" {
+		params.Set("operationName", operationName)
+	}
+	return httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+}
+
+func postRequest(origin string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query":"mutation { logout }"}`))
+	r.Header.Set("Content-Type", "application/json")
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	return r
+}
+
+func TestCSRFRejectsMutationOverGETWithCookie(t *testing.T) {
+	handler, called := csrfTestHandler()
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, withAuthCookie(getRequest(`mutation { deleteUser(id: "64b000000000000000000000") }`, "")))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+	if *called {
+		t.Error("mutation over GET reached the handler")
+	}
+}
+
+func TestCSRFRejectsNamedMutationInMultiOperationGET(t *testing.T) {
+	handler, called := csrfTestHandler()
+	rec := httptest.NewRecorder()
+
+	query := `query Me { me { id } } mutation Out { logout }`
+	handler.ServeHTTP(rec, withAuthCookie(getRequest(query, "Out")))
+
+	if rec.Code != http.StatusMethodNotAllowed || *called {
+		t.Errorf("status = %d, called = %v; want mutation rejected", rec.Code, *called)
+	}
+}
+
+func TestCSRFAllowsQueryOverGET(t *testing.T) {
+	handler, called := csrfTestHandler()
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, withAuthCookie(getRequest(`{ me { id } }`, "")))
+
+	if rec.Code != http.StatusOK || !*called {
+		t.Errorf("status = %d, called = %v; want query passed through", rec.Code, *called)
+	}
+}
+
+func TestCSRFOriginCheckForCookiePOST(t *testing.T) {
+	cases := []struct {
+		name    string
+		request *http.Request
+		want    int
+	}{
+		{"allowed origin", withAuthCookie(postRequest(testOrigin)), http.StatusOK},
+		{"foreign origin", withAuthCookie(postRequest("https://evil.example")), http.StatusForbidden},
+		{"no origin", withAuthCookie(postRequest("")), http.StatusForbidden},
+		{"no cookie", postRequest("https://evil.example"), http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler, _ := csrfTestHandler()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, c.request)
+			if rec.Code != c.want {
+				t.Errorf("status = %d, want %d", rec.Code, c.want)
+			}
+		})
+	}
+}
+
+func TestCSRFRefererFallbackAndBearer(t *testing.T) {
+	handler, _ := csrfTestHandler()
+
+	r := withAuthCookie(postRequest(""))
+	r.Header.Set("Referer", testOrigin+"/dashboard")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("referer from allowed origin: status = %d, want 200", rec.Code)
+	}
+
+	r = withAuthCookie(postRequest("https://evil.example"))
+	r.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("bearer request: status = %d, want 200", rec.Code)
+	}
+}
@@ -2,14 +2,32 @@ module github.com/DGISsoft/DGISback/middleware
 
 go 1.24.0
 
-require github.com/DGISsoft/DGISback/api v0.0.0-20250814140204-1b14b01c9c11
+require (
+	github.com/DGISsoft/DGISback/api v0.0.0-20250814140204-1b14b01c9c11
+	github.com/DGISsoft/DGISback/env v0.0.0-20250817203408-c9c1fa8b31bb
+	github.com/DGISsoft/DGISback/models v0.0.0-20250814101323-a0394232d74e
+	github.com/DGISsoft/DGISback/services v0.0.0-20250817192649-ff1647db30cf
+	github.com/vektah/gqlparser/v2 v2.5.30
+	go.mongodb.org/mongo-driver v1.17.4
+)
 
 require (
 	github.com/99designs/gqlgen v0.17.78 // indirect
-	github.com/DGISsoft/DGISback/models v0.0.0-20250814101323-a0394232d74e // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+	github.com/golang/snappy v1.0.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
+	github.com/joho/godotenv v1.5.1 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/montanaflynn/stats v0.7.1 // indirect
+	github.com/redis/go-redis/v9 v9.12.1 // indirect
 	github.com/sosodev/duration v1.3.1 // indirect
-	github.com/vektah/gqlparser/v2 v2.5.30 // indirect
-	go.mongodb.org/mongo-driver v1.17.4 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 )
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type APIKeyScope string
+
+const (
+	APIKeyScopeUsersRead         APIKeyScope = "USERS_READ"
+	APIKeyScopeDashboardRead     APIKeyScope = "DASHBOARD_READ"
+	APIKeyScopeNotificationsRead APIKeyScope = "NOTIFICATIONS_READ"
+	APIKeyScopeNotificationsSend APIKeyScope = "NOTIFICATIONS_SEND"
+)
+
+func (s APIKeyScope) IsValid() bool {
+	switch s {
+	case APIKeyScopeUsersRead, APIKeyScopeDashboardRead, APIKeyScopeNotificationsRead, APIKeyScopeNotificationsSend:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIKey — долгоживущий ключ сервисного аккаунта (бот, cron). Сам ключ не хранится, только его SHA-256.
+// Запросы по ключу выполняются от имени создавшего его пользователя с ролью на момент создания,
+// но не выше его текущей роли.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	KeyHash    string             `bson:"keyHash" json:"-"`
+	Scopes     []APIKeyScope      `bson:"scopes" json:"scopes"`
+	OwnerID    primitive.ObjectID `bson:"ownerId" json:"ownerId"`
+	Role       UserRole           `bson:"role" json:"role"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	LastUsedIP string             `bson:"lastUsedIp,omitempty" json:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+func (k *APIKey) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || k.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuditAction string
+
+const (
+	AuditActionUserCreate         AuditAction = "USER_CREATE"
+	AuditActionUserUpdate         AuditAction = "USER_UPDATE"
+	AuditActionUserImport         AuditAction = "USER_IMPORT"
+	AuditActionUserExport         AuditAction = "USER_EXPORT"
+	AuditActionUserDelete         AuditAction = "USER_DELETE"
+	AuditActionUserDeactivate     AuditAction = "USER_DEACTIVATE"
+	AuditActionUserRestore        AuditAction = "USER_RESTORE"
+	AuditActionUserPurge          AuditAction = "USER_PURGE"
+	AuditActionUserInvite         AuditAction = "USER_INVITE"
+	AuditActionInviteRevoke       AuditAction = "INVITE_REVOKE"
+	AuditActionUserUnlock         AuditAction = "USER_UNLOCK"
+	AuditActionUserPasswordReset  AuditAction = "USER_PASSWORD_RESET"
+	AuditActionUserTwoFactorReset AuditAction = "USER_TWO_FACTOR_RESET"
+	AuditActionUserSessionsRevoke AuditAction = "USER_SESSIONS_REVOKE"
+	AuditActionMarkerCreate       AuditAction = "MARKER_CREATE"
+	AuditActionMarkerUpdate       AuditAction = "MARKER_UPDATE"
+	AuditActionMarkerDelete       AuditAction = "MARKER_DELETE"
+	AuditActionMarkerImport       AuditAction = "MARKER_IMPORT"
+	AuditActionMarkerAssignUser   AuditAction = "MARKER_ASSIGN_USER"
+	AuditActionMarkerRemoveUser   AuditAction = "MARKER_REMOVE_USER"
+	AuditActionNotificationSend   AuditAction = "NOTIFICATION_SEND"
+	AuditActionAPIKeyCreate       AuditAction = "API_KEY_CREATE"
+	AuditActionAPIKeyRevoke       AuditAction = "API_KEY_REVOKE"
+)
+
+// AuditEntry — запись журнала привилегированных действий. Записи только добавляются.
+// Before и After — снимки затронутых объектов без секретов (сериализуются по json-тегам).
+type AuditEntry struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Timestamp  time.Time            `bson:"timestamp" json:"timestamp"`
+	ActorID    primitive.ObjectID   `bson:"actorId" json:"actorId"`
+	ActorLogin string               `bson:"actorLogin" json:"actorLogin"`
+	ActorRole  UserRole             `bson:"actorRole" json:"actorRole"`
+	APIKeyID   string               `bson:"apiKeyId,omitempty" json:"apiKeyId,omitempty"`
+	Action     AuditAction          `bson:"action" json:"action"`
+	TargetIDs  []primitive.ObjectID `bson:"targetIds" json:"targetIds"`
+	Summary    string               `bson:"summary" json:"summary"`
+	Before     map[string]any       `bson:"before,omitempty" json:"before,omitempty"`
+	After      map[string]any       `bson:"after,omitempty" json:"after,omitempty"`
+	IP         string               `bson:"ip" json:"ip"`
+	UserAgent  string               `bson:"userAgent" json:"userAgent"`
+}
@@ -29,6 +29,8 @@ type Notification struct {
 	Title        string               `bson:"title" json:"title"`
 	Message      string               `bson:"message" json:"message"`
 	SenderID     primitive.ObjectID   `bson:"senderId" json:"senderId"`
+	// Заполняется вместо SenderID, когда отправитель окончательно удалён
+	SenderName   string               `bson:"senderName,omitempty" json:"senderName,omitempty"`
 	RecipientIDs []primitive.ObjectID `bson:"recipientIds,omitempty" json:"recipientIds,omitempty"`
 	CreatedAt    time.Time            `bson:"createdAt" json:"createdAt"`
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
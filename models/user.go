@@ -15,6 +15,18 @@ const (
     UserRoleSupervisor  UserRole = "SUPERVISOR"
 )
 
+type UserStatus string
+
+const (
+    // Приглашён, но ещё не принял приглашение: логина и пароля нет
+    UserStatusPending     UserStatus = "PENDING"
+    UserStatusActive      UserStatus = "ACTIVE"
+    // Вход запрещён, пользователь скрыт с карты; история и назначения сохраняются
+    UserStatusDeactivated UserStatus = "DEACTIVATED"
+    // Удалён с возможностью восстановления до окончательной очистки
+    UserStatusDeleted     UserStatus = "DELETED"
+)
+
 var RoleHierarchy = map[UserRole]int{
     UserRoleSupervisor: 1,
     UserRoleStarosta:   2,
@@ -31,12 +43,41 @@ type User struct {
     Building     *string            `json:"building,omitempty" bson:"building,omitempty"`
     PhoneNumber  string             `json:"phone_number" bson:"phone_number"`
     TelegramTag  string             `json:"telegram_tag" bson:"telegram_tag"`
+    // Telegram user ID, привязывается самим пользователем через linkMyTelegram
+    TelegramID   string             `json:"-" bson:"telegram_id,omitempty"`
     Markers     []primitive.ObjectID `bson:"assignedMarkers" json:"markers"`
+    // Пустой статус у пользователей, созданных до приглашений, означает ACTIVE
+    Status       UserStatus         `json:"status,omitempty" bson:"status,omitempty"`
+    DeactivatedAt *time.Time        `json:"deactivated_at,omitempty" bson:"deactivated_at,omitempty"`
+    DeletedAt    *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+    LockedUntil  *time.Time         `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+    MustChangePassword bool         `json:"must_change_password" bson:"must_change_password"`
+    // Второй фактор (TOTP). Секрет ожидает подтверждения первым кодом в TOTPPendingSecret
+    TOTPEnabled       bool          `json:"totp_enabled" bson:"totp_enabled"`
+    TOTPSecret        string        `json:"-" bson:"totp_secret,omitempty"`
+    TOTPPendingSecret string        `json:"-" bson:"totp_pending_secret,omitempty"`
+    RecoveryCodes     []string      `json:"-" bson:"recovery_codes,omitempty"`
     CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
     UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
 
+func (u *User) IsActive() bool {
+    return u.Status == "" || u.Status == UserStatusActive
+}
+
+// CurrentStatus возвращает статус с учётом пользователей, созданных до появления статусов
+func (u *User) CurrentStatus() UserStatus {
+    if u.Status == "" {
+        return UserStatusActive
+    }
+    return u.Status
+}
+
+func (u *User) IsLocked() bool {
+    return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
+}
+
 func (u *User) HasHigherRole(role UserRole) bool {
     userRoleLevel := RoleHierarchy[u.Role]
     targetRoleLevel := RoleHierarchy[role]
@@ -50,6 +91,10 @@ func (u *User) HasEqualOrHigherRole(role UserRole) bool {
     return userRoleLevel >= targetRoleLevel
 }
 
+func (r UserRole) IsAtLeast(role UserRole) bool {
+    return RoleHierarchy[r] >= RoleHierarchy[role]
+}
+
 func (r UserRole) IsValid() bool {
     switch r {
     case UserRolePredsedatel, UserRoleDgis, UserRoleStarosta, UserRoleSupervisor:
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidPhoneNumber = errors.New("phone number must be in E.164 format, e.g. +79991234567")
+	ErrInvalidTelegramTag = errors.New("telegram tag must be 5-32 characters: latin letters, digits and underscores, starting with a letter")
+	ErrEmptyFullName      = errors.New("full name must not be empty")
+	ErrEmptyMarkerID      = errors.New("marker id must not be empty")
+	ErrEmptyMarkerLabel   = errors.New("marker label must not be empty")
+	ErrInvalidPosition    = errors.New("position must be a [latitude, longitude] pair with latitude in [-90, 90] and longitude in [-180, 180]")
+
+	e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	// Правила username в Telegram: 5-32 символа, начинается с буквы, не заканчивается подчёркиванием
+	telegramTagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{3,30}[A-Za-z0-9]$`)
+	phoneSeparators    = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+)
+
+// NormalizePhoneNumber убирает пробелы, дефисы и скобки и проверяет номер на соответствие E.164
+func NormalizePhoneNumber(phone string) (string, error) {
+	normalized := phoneSeparators.Replace(strings.TrimSpace(phone))
+	if !e164Pattern.MatchString(normalized) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return normalized, nil
+}
+
+// NormalizeTelegramTag проверяет username Telegram и приводит его к виду @username
+func NormalizeTelegramTag(tag string) (string, error) {
+	username := strings.TrimPrefix(strings.TrimSpace(tag), "@")
+	if !telegramTagPattern.MatchString(username) {
+		return "", ErrInvalidTelegramTag
+	}
+	return "@" + username, nil
+}
+
+func NormalizeFullName(fullName string) (string, error) {
+	normalized := strings.Join(strings.Fields(fullName), " ")
+	if normalized == "" {
+		return "", ErrEmptyFullName
+	}
+	return normalized, nil
+}
+
+func NormalizeMarkerID(markerID string) (string, error) {
+	normalized := strings.TrimSpace(markerID)
+	if normalized == "" {
+		return "", ErrEmptyMarkerID
+	}
+	return normalized, nil
+}
+
+func NormalizeMarkerLabel(label string) (string, error) {
+	normalized := strings.Join(strings.Fields(label), " ")
+	if normalized == "" {
+		return "", ErrEmptyMarkerLabel
+	}
+	return normalized, nil
+}
+
+// ValidatePosition проверяет, что position — пара [широта, долгота] в допустимых пределах
+func ValidatePosition(position []float64) error {
+	if len(position) != 2 {
+		return ErrInvalidPosition
+	}
+	lat, lng := position[0], position[1]
+	if math.IsNaN(lat) || math.IsNaN(lng) || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return ErrInvalidPosition
+	}
+	return nil
+}
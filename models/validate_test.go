@@ -0,0 +1,60 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	cases := map[string]string{
+		"+79991234567":        "+79991234567",
+		" +7 (999) 123-45-67": "+79991234567",
+		"+12025550123":        "+12025550123",
+	}
+	for input, want := range cases {
+		got, err := NormalizePhoneNumber(input)
+		if err != nil || got != want {
+			t.Errorf("NormalizePhoneNumber(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "89991234567", "+0123456", "+7999123456789012", "+7abc"} {
+		if _, err := NormalizePhoneNumber(input); err != ErrInvalidPhoneNumber {
+			t.Errorf("NormalizePhoneNumber(%q) error = %v; want ErrInvalidPhoneNumber", input, err)
+		}
+	}
+}
+
+func TestNormalizeTelegramTag(t *testing.T) {
+	cases := map[string]string{
+		"@durov_bot": "@durov_bot",
+		"Ivan_2004":  "@Ivan_2004",
+		" @abcde ":   "@abcde",
+	}
+	for input, want := range cases {
+		got, err := NormalizeTelegramTag(input)
+		if err != nil || got != want {
+			t.Errorf("NormalizeTelegramTag(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "@abcd", "1abcde", "abcde_", "иван_петров", "abc-def", "@a23456789012345678901234567890123"} {
+		if _, err := NormalizeTelegramTag(input); err != ErrInvalidTelegramTag {
+			t.Errorf("NormalizeTelegramTag(%q) error = %v; want ErrInvalidTelegramTag", input, err)
+		}
+	}
+}
+
+func TestValidatePosition(t *testing.T) {
+	for _, position := range [][]float64{{55.7558, 37.6173}, {-90, 180}, {90, -180}, {0, 0}} {
+		if err := ValidatePosition(position); err != nil {
+			t.Errorf("ValidatePosition(%v) = %v; want nil", position, err)
+		}
+	}
+
+	for _, position := range [][]float64{nil, {55.7}, {55.7, 37.6, 0}, {90.1, 0}, {0, -180.5}, {math.NaN(), 0}, {0, math.Inf(1)}} {
+		if err := ValidatePosition(position); err != ErrInvalidPosition {
+			t.Errorf("ValidatePosition(%v) error = %v; want ErrInvalidPosition", position, err)
+		}
+	}
+}
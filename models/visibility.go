@@ -0,0 +1,86 @@
+package models
+
+// ViewerRelation описывает, кем смотрящий приходится пользователю, чьи данные запрошены
+type ViewerRelation uint8
+
+const (
+	RelationSelf ViewerRelation = 1 << iota
+	// Общий маркер (корпус) или совпадающее поле building
+	RelationSameBuilding
+	// Роль смотрящего строго выше роли пользователя
+	RelationHigherRole
+)
+
+type UserField string
+
+const (
+	UserFieldPhoneNumber        UserField = "phoneNumber"
+	UserFieldTelegramTag        UserField = "telegramTag"
+	UserFieldBuilding           UserField = "building"
+	UserFieldLockedUntil        UserField = "lockedUntil"
+	UserFieldMustChangePassword UserField = "mustChangePassword"
+	UserFieldTwoFactorEnabled   UserField = "twoFactorEnabled"
+)
+
+// userFieldVisibility — единственное место, где задаётся, кому видны персональные данные.
+// Поля без записи видны всем авторизованным; скрытые поля отдаются как null.
+var userFieldVisibility = map[UserField]ViewerRelation{
+	UserFieldPhoneNumber:        RelationSelf | RelationSameBuilding | RelationHigherRole,
+	UserFieldTelegramTag:        RelationSelf | RelationSameBuilding | RelationHigherRole,
+	UserFieldBuilding:           RelationSelf | RelationSameBuilding | RelationHigherRole,
+	UserFieldLockedUntil:        RelationSelf | RelationHigherRole,
+	UserFieldMustChangePassword: RelationSelf | RelationHigherRole,
+	UserFieldTwoFactorEnabled:   RelationSelf | RelationHigherRole,
+}
+
+// RelationTo вычисляет отношение смотрящего к subject. role — роль из токена:
+// для API-ключа она может отличаться от текущей роли владельца.
+func (u *User) RelationTo(role UserRole, subject *User) ViewerRelation {
+	if u == nil || subject == nil {
+		return 0
+	}
+
+	var relation ViewerRelation
+	if u.ID == subject.ID {
+		relation |= RelationSelf
+	}
+	if RoleHierarchy[role] > RoleHierarchy[subject.Role] {
+		relation |= RelationHigherRole
+	}
+	if u.SharesBuilding(subject) {
+		relation |= RelationSameBuilding
+	}
+	return relation
+}
+
+func (u *User) SharesBuilding(other *User) bool {
+	if u.Building != nil && other.Building != nil && *u.Building != "" && *u.Building == *other.Building {
+		return true
+	}
+	for _, markerID := range u.Markers {
+		for _, otherMarkerID := range other.Markers {
+			if markerID == otherMarkerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r ViewerRelation) CanView(field UserField) bool {
+	allowed, restricted := userFieldVisibility[field]
+	return !restricted || r&allowed != 0
+}
+
+// ListableRoles — роли пользователей, которых role видит в списках; nil — все роли.
+// ok == false, если списки пользователей для роли закрыты.
+func ListableRoles(role UserRole) (roles []UserRole, ok bool) {
+	switch role {
+	case UserRoleDgis:
+		return nil, true
+	case UserRolePredsedatel:
+		return []UserRole{UserRoleStarosta, UserRoleSupervisor}, true
+	default:
+		return nil, false
+	}
+}
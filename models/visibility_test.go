@@ -0,0 +1,96 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRelationTo(t *testing.T) {
+	building := "Корпус 1"
+	otherBuilding := "Корпус 2"
+	marker := primitive.NewObjectID()
+
+	viewer := &User{ID: primitive.NewObjectID(), Role: UserRoleStarosta, Building: &building, Markers: []primitive.ObjectID{marker}}
+
+	tests := []struct {
+		name    string
+		role    UserRole
+		subject *User
+		want    ViewerRelation
+	}{
+		{"self", UserRoleStarosta, viewer, RelationSelf | RelationSameBuilding},
+		{"same building by label", UserRoleStarosta,
+			&User{ID: primitive.NewObjectID(), Role: UserRoleStarosta, Building: &building}, RelationSameBuilding},
+		{"same building by marker", UserRoleStarosta,
+			&User{ID: primitive.NewObjectID(), Role: UserRoleStarosta, Building: &otherBuilding, Markers: []primitive.ObjectID{marker}}, RelationSameBuilding},
+		{"higher role", UserRoleStarosta,
+			&User{ID: primitive.NewObjectID(), Role: UserRoleSupervisor, Building: &otherBuilding}, RelationHigherRole},
+		{"equal role", UserRoleStarosta,
+			&User{ID: primitive.NewObjectID(), Role: UserRoleStarosta, Building: &otherBuilding}, 0},
+		// Ключ выпущен со старостой, хотя владелец — председатель: решает роль из токена
+		{"api key role below owner role", UserRoleStarosta,
+			&User{ID: primitive.NewObjectID(), Role: UserRoleDgis}, 0},
+		{"api key role above subject", UserRolePredsedatel,
+			&User{ID: primitive.NewObjectID(), Role: UserRoleDgis}, RelationHigherRole},
+		{"nil subject", UserRoleStarosta, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := viewer.RelationTo(tt.role, tt.subject); got != tt.want {
+				t.Errorf("RelationTo = %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharesBuilding(t *testing.T) {
+	building := "Корпус 1"
+	same := "Корпус 1"
+	empty := ""
+	marker := primitive.NewObjectID()
+
+	tests := []struct {
+		name        string
+		user, other *User
+		want        bool
+	}{
+		{"same label", &User{Building: &building}, &User{Building: &same}, true},
+		{"shared marker", &User{Markers: []primitive.ObjectID{marker}}, &User{Markers: []primitive.ObjectID{primitive.NewObjectID(), marker}}, true},
+		{"empty labels", &User{Building: &empty}, &User{Building: &empty}, false},
+		{"no building", &User{}, &User{Building: &building}, false},
+		{"different markers", &User{Markers: []primitive.ObjectID{marker}}, &User{Markers: []primitive.ObjectID{primitive.NewObjectID()}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.SharesBuilding(tt.other); got != tt.want {
+				t.Errorf("SharesBuilding = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanView(t *testing.T) {
+	tests := []struct {
+		relation ViewerRelation
+		field    UserField
+		want     bool
+	}{
+		{RelationSelf, UserFieldPhoneNumber, true},
+		{RelationSelf, UserFieldTwoFactorEnabled, true},
+		{RelationSameBuilding, UserFieldTelegramTag, true},
+		{RelationSameBuilding, UserFieldLockedUntil, false},
+		{RelationSameBuilding, UserFieldMustChangePassword, false},
+		{RelationHigherRole, UserFieldLockedUntil, true},
+		{RelationHigherRole, UserFieldBuilding, true},
+		{0, UserFieldPhoneNumber, false},
+		{0, UserFieldBuilding, false},
+		// Поля без правила видны всем
+		{0, UserField("fullName"), true},
+	}
+	for _, tt := range tests {
+		if got := tt.relation.CanView(tt.field); got != tt.want {
+			t.Errorf("ViewerRelation(%b).CanView(%s) = %v, want %v", tt.relation, tt.field, got, tt.want)
+		}
+	}
+}
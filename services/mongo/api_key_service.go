@@ -0,0 +1,216 @@
+package mongo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	APIKeyPrefix = "dgis_"
+	// Сколько символов ключа храним открыто, чтобы администратор мог его узнать в списке
+	apiKeyVisibleLength = 12
+	// Не пишем lastUsedAt чаще этого интервала
+	apiKeyTouchInterval = time.Minute
+)
+
+var ErrAPIKeyInvalid = errors.New("api key is invalid, revoked or expired")
+
+type APIKeyService struct {
+	*MongoService
+}
+
+func NewAPIKeyService(mongoService *MongoService) *APIKeyService {
+	return &APIKeyService{MongoService: mongoService}
+}
+
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// CreateAPIKey сохраняет ключ и возвращает его открытое значение; повторно получить его нельзя
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, key *models.APIKey) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	rawKey := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	key.Prefix = rawKey[:apiKeyVisibleLength]
+	key.KeyHash = hashAPIKey(rawKey)
+	key.CreatedAt = time.Now()
+
+	collection := s.GetCollection("api_keys")
+	res, err := collection.InsertOne(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		key.ID = oid
+	} else {
+		return "", fmt.Errorf("failed to get inserted api key ID, expected ObjectID, got %T", res.InsertedID)
+	}
+
+	log.Printf("APIKeyService: Created api key %s (%s) for owner %s", key.ID.Hex(), key.Name, key.OwnerID.Hex())
+	return rawKey, nil
+}
+
+// EnsureAPIKeyIndexes создаёт уникальный индекс по keyHash, по которому ищется ключ при входе
+func (s *APIKeyService) EnsureAPIKeyIndexes(ctx context.Context) error {
+	collection := s.GetCollection("api_keys")
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "keyHash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create api key indexes: %w", err)
+	}
+
+	return nil
+}
+
+// Authenticate находит активный ключ по открытому значению и отмечает его использование.
+// Роль ключа не может быть выше текущей роли владельца, а ключи неактивного владельца не принимаются.
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey, ip string) (*models.APIKey, error) {
+	collection := s.GetCollection("api_keys")
+
+	var key models.APIKey
+	err := query.FindOne(ctx, collection, bson.M{"keyHash": hashAPIKey(rawKey)}, &key)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if !key.IsActive() {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	var owner models.User
+	err = query.FindByID(ctx, s.GetCollection("users"), key.OwnerID, &owner)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key owner: %w", err)
+	}
+	if !owner.IsActive() {
+		return nil, ErrAPIKeyInvalid
+	}
+	if !owner.Role.IsAtLeast(key.Role) {
+		key.Role = owner.Role
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval || key.LastUsedIP != ip {
+		now := time.Now()
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": key.ID}, bson.M{
+			"$set": bson.M{"lastUsedAt": now, "lastUsedIp": ip},
+		})
+		if err != nil {
+			log.Printf("APIKeyService: Failed to record usage of api key %s: %v", key.ID.Hex(), err)
+		} else {
+			key.LastUsedAt = &now
+			key.LastUsedIP = ip
+		}
+	}
+
+	return &key, nil
+}
+
+// GetAPIKeys возвращает ключи, которые видит requester: свои и ключи с ролью ниже его собственной
+func (s *APIKeyService) GetAPIKeys(ctx context.Context, requester *models.User) ([]*models.APIKey, error) {
+	collection := s.GetCollection("api_keys")
+
+	lowerRoles := []models.UserRole{}
+	for role := range models.RoleHierarchy {
+		if requester.HasHigherRole(role) {
+			lowerRoles = append(lowerRoles, role)
+		}
+	}
+	filter := bson.M{"$or": []bson.M{
+		{"ownerId": requester.ID},
+		{"role": bson.M{"$in": lowerRoles}},
+	}}
+
+	var keys []*models.APIKey
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	err := query.FindMany(ctx, collection, filter, &keys, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeyService) GetAPIKeyByID(ctx context.Context, id primitive.ObjectID) (*models.APIKey, error) {
+	collection := s.GetCollection("api_keys")
+
+	var key models.APIKey
+	err := query.FindByID(ctx, collection, id, &key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("api key not found")
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id primitive.ObjectID) error {
+	collection := s.GetCollection("api_keys")
+
+	result, err := collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("api key %s not found or already revoked", id.Hex())
+	}
+
+	log.Printf("APIKeyService: Revoked api key %s", id.Hex())
+	return nil
+}
+
+// RevokeOwnerAPIKeys отзывает все действующие ключи пользователя, например при его деактивации
+func (s *APIKeyService) RevokeOwnerAPIKeys(ctx context.Context, ownerID primitive.ObjectID) (int64, error) {
+	collection := s.GetCollection("api_keys")
+
+	result, err := collection.UpdateMany(
+		ctx,
+		bson.M{"ownerId": ownerID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke api keys: %w", err)
+	}
+
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,99 @@
+// services/mongo/audit_service.go
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditService пишет в append-only коллекцию audit_log: методов изменения и удаления записей нет
+type AuditService struct {
+	*MongoService
+}
+
+func NewAuditService(mongoService *MongoService) *AuditService {
+	return &AuditService{MongoService: mongoService}
+}
+
+type AuditFilter struct {
+	ActorID  *primitive.ObjectID
+	TargetID *primitive.ObjectID
+	Actions  []models.AuditAction
+	From     *time.Time
+	To       *time.Time
+}
+
+func (f AuditFilter) toBSON() bson.M {
+	filter := bson.M{}
+	if f.ActorID != nil {
+		filter["actorId"] = *f.ActorID
+	}
+	if f.TargetID != nil {
+		filter["targetIds"] = *f.TargetID
+	}
+	if len(f.Actions) > 0 {
+		filter["action"] = bson.M{"$in": f.Actions}
+	}
+	if f.From != nil || f.To != nil {
+		period := bson.M{}
+		if f.From != nil {
+			period["$gte"] = *f.From
+		}
+		if f.To != nil {
+			period["$lt"] = *f.To
+		}
+		filter["timestamp"] = period
+	}
+	return filter
+}
+
+func (s *AuditService) Record(ctx context.Context, entry *models.AuditEntry) error {
+	collection := s.GetCollection("audit_log")
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if entry.TargetIDs == nil {
+		entry.TargetIDs = []primitive.ObjectID{}
+	}
+
+	res, err := collection.InsertOne(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		entry.ID = oid
+	}
+
+	return nil
+}
+
+// FindEntries возвращает записи от новых к старым. after — ID последней записи предыдущей страницы.
+func (s *AuditService) FindEntries(ctx context.Context, filter AuditFilter, after *primitive.ObjectID, limit int64) ([]*models.AuditEntry, error) {
+	collection := s.GetCollection("audit_log")
+
+	mongoFilter := filter.toBSON()
+	if after != nil {
+		mongoFilter["_id"] = bson.M{"$lt": *after}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(limit)
+
+	var entries []*models.AuditEntry
+	err := query.FindMany(ctx, collection, mongoFilter, &entries, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit entries: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,107 @@
+// services/mongo/invite_service.go
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type InviteService struct {
+	*MongoService
+}
+
+func NewInviteService(mongoService *MongoService) *InviteService {
+	return &InviteService{MongoService: mongoService}
+}
+
+func (s *InviteService) CreateInvite(ctx context.Context, invite *models.Invite) error {
+	collection := s.GetCollection("invites")
+
+	invite.CreatedAt = time.Now()
+
+	res, err := collection.InsertOne(ctx, invite)
+	if err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		invite.ID = oid
+		log.Printf("InviteService: Created invite %s for user %s", invite.ID.Hex(), invite.UserID.Hex())
+	} else {
+		return fmt.Errorf("failed to get inserted invite ID, expected ObjectID, got %T", res.InsertedID)
+	}
+
+	return nil
+}
+
+func (s *InviteService) GetInviteByID(ctx context.Context, id primitive.ObjectID) (*models.Invite, error) {
+	collection := s.GetCollection("invites")
+
+	var invite models.Invite
+	err := query.FindByID(ctx, collection, id, &invite)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("invite not found")
+		}
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+
+	return &invite, nil
+}
+
+// GetPendingInvites возвращает не принятые и не отозванные приглашения, включая истёкшие
+func (s *InviteService) GetPendingInvites(ctx context.Context) ([]*models.Invite, error) {
+	collection := s.GetCollection("invites")
+
+	filter := bson.M{
+		"acceptedAt": bson.M{"$exists": false},
+		"revokedAt":  bson.M{"$exists": false},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	var invites []*models.Invite
+	err := query.FindMany(ctx, collection, filter, &invites, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+
+	return invites, nil
+}
+
+// AcceptInvite атомарно помечает приглашение принятым; повторное принятие вернёт ошибку
+func (s *InviteService) AcceptInvite(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	return s.closeInvite(ctx, id, bson.M{"expiresAt": bson.M{"$gt": now}}, bson.M{"acceptedAt": now})
+}
+
+// RevokeInvite отзывает приглашение, в том числе уже истёкшее
+func (s *InviteService) RevokeInvite(ctx context.Context, id primitive.ObjectID) error {
+	return s.closeInvite(ctx, id, bson.M{}, bson.M{"revokedAt": time.Now()})
+}
+
+func (s *InviteService) closeInvite(ctx context.Context, id primitive.ObjectID, filter bson.M, set bson.M) error {
+	collection := s.GetCollection("invites")
+
+	filter["_id"] = id
+	filter["acceptedAt"] = bson.M{"$exists": false}
+	filter["revokedAt"] = bson.M{"$exists": false}
+
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to update invite: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("invite %s is not pending", id.Hex())
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+// services/mongo/marker_links.go
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/DGISsoft/DGISback/services/mongo/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LinkIssueKind string
+
+const (
+	// Маркер ссылается на пользователя, а пользователь на маркер — нет
+	LinkIssueMarkerOnly LinkIssueKind = "MARKER_ONLY_LINK"
+	// Пользователь ссылается на маркер, а маркер на пользователя — нет
+	LinkIssueUserOnly LinkIssueKind = "USER_ONLY_LINK"
+	// В assignedUserIds маркера есть несуществующий пользователь
+	LinkIssueDanglingUser LinkIssueKind = "DANGLING_USER_ID"
+	// В assignedMarkers пользователя есть несуществующий маркер
+	LinkIssueDanglingMarker LinkIssueKind = "DANGLING_MARKER_ID"
+	// building пользователя не совпадает с подписью ни одного из его маркеров
+	LinkIssueBuildingMismatch LinkIssueKind = "BUILDING_MISMATCH"
+)
+
+// LinkIssue — одно расхождение между markers и users. Для BUILDING_MISMATCH MarkerID —
+// маркер, чья подпись будет записана в building.
+type LinkIssue struct {
+	Kind             LinkIssueKind
+	MarkerID         primitive.ObjectID
+	UserID           primitive.ObjectID
+	Building         *string
+	ExpectedBuilding *string
+}
+
+// Fix описывает исправление в виде строки диффа
+func (i LinkIssue) Fix() string {
+	switch i.Kind {
+	case LinkIssueMarkerOnly:
+		return fmt.Sprintf("+ users[%s].assignedMarkers %s", i.UserID.Hex(), i.MarkerID.Hex())
+	case LinkIssueUserOnly:
+		return fmt.Sprintf("+ markers[%s].assignedUserIds %s", i.MarkerID.Hex(), i.UserID.Hex())
+	case LinkIssueDanglingUser:
+		return fmt.Sprintf("- markers[%s].assignedUserIds %s", i.MarkerID.Hex(), i.UserID.Hex())
+	case LinkIssueDanglingMarker:
+		return fmt.Sprintf("- users[%s].assignedMarkers %s", i.UserID.Hex(), i.MarkerID.Hex())
+	case LinkIssueBuildingMismatch:
+		return fmt.Sprintf("~ users[%s].building %s -> %s", i.UserID.Hex(), quoteBuilding(i.Building), quoteBuilding(i.ExpectedBuilding))
+	default:
+		return ""
+	}
+}
+
+func quoteBuilding(building *string) string {
+	if building == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%q", *building)
+}
+
+type LinkReport struct {
+	MarkersScanned int
+	UsersScanned   int
+	Issues         []LinkIssue
+}
+
+type linkMarker struct {
+	ID      primitive.ObjectID   `bson:"_id"`
+	Label   string               `bson:"label"`
+	UserIDs []primitive.ObjectID `bson:"assignedUserIds"`
+}
+
+type linkUser struct {
+	ID       primitive.ObjectID   `bson:"_id"`
+	Markers  []primitive.ObjectID `bson:"assignedMarkers"`
+	Building *string              `bson:"building"`
+}
+
+// checkLinks сравнивает обе стороны связи. Односторонняя ссылка считается назначением,
+// которое не дописалось, и восстанавливается; ссылки на несуществующие документы удаляются.
+// building сверяется с маркерами пользователя уже после этих исправлений.
+func checkLinks(markers []linkMarker, users []linkUser) *LinkReport {
+	report := &LinkReport{MarkersScanned: len(markers), UsersScanned: len(users)}
+
+	markersByID := make(map[primitive.ObjectID]*linkMarker, len(markers))
+	for i := range markers {
+		markersByID[markers[i].ID] = &markers[i]
+	}
+	usersByID := make(map[primitive.ObjectID]*linkUser, len(users))
+	for i := range users {
+		usersByID[users[i].ID] = &users[i]
+	}
+
+	// Маркеры, которые окажутся у пользователя после исправлений, в порядке $addToSet
+	assigned := make(map[primitive.ObjectID][]primitive.ObjectID, len(users))
+	for _, user := range users {
+		for _, markerID := range user.Markers {
+			marker, ok := markersByID[markerID]
+			switch {
+			case !ok:
+				report.Issues = append(report.Issues, LinkIssue{Kind: LinkIssueDanglingMarker, MarkerID: markerID, UserID: user.ID})
+				continue
+			case !slices.Contains(marker.UserIDs, user.ID):
+				report.Issues = append(report.Issues, LinkIssue{Kind: LinkIssueUserOnly, MarkerID: markerID, UserID: user.ID})
+			}
+			if !slices.Contains(assigned[user.ID], markerID) {
+				assigned[user.ID] = append(assigned[user.ID], markerID)
+			}
+		}
+	}
+
+	for _, marker := range markers {
+		seen := make(map[primitive.ObjectID]bool, len(marker.UserIDs))
+		for _, userID := range marker.UserIDs {
+			if seen[userID] {
+				continue
+			}
+			seen[userID] = true
+
+			user, ok := usersByID[userID]
+			switch {
+			case !ok:
+				report.Issues = append(report.Issues, LinkIssue{Kind: LinkIssueDanglingUser, MarkerID: marker.ID, UserID: userID})
+			case !slices.Contains(user.Markers, marker.ID):
+				report.Issues = append(report.Issues, LinkIssue{Kind: LinkIssueMarkerOnly, MarkerID: marker.ID, UserID: userID})
+				assigned[userID] = append(assigned[userID], marker.ID)
+			}
+		}
+	}
+
+	// Пользователи без маркеров не проверяются: их building задаётся вручную
+	for _, user := range users {
+		markerIDs := assigned[user.ID]
+		if len(markerIDs) == 0 {
+			continue
+		}
+		matches := slices.ContainsFunc(markerIDs, func(markerID primitive.ObjectID) bool {
+			return user.Building != nil && markersByID[markerID].Label == *user.Building
+		})
+		if matches {
+			continue
+		}
+		// Как и при снятии с маркера, building берётся с первого оставшегося маркера
+		expected := markersByID[markerIDs[0]].Label
+		report.Issues = append(report.Issues, LinkIssue{
+			Kind:             LinkIssueBuildingMismatch,
+			MarkerID:         markerIDs[0],
+			UserID:           user.ID,
+			Building:         user.Building,
+			ExpectedBuilding: &expected,
+		})
+	}
+
+	return report
+}
+
+// CheckLinks ищет расхождения между markers.assignedUserIds, users.assignedMarkers и users.building, ничего не меняя
+func (s *MarkerService) CheckLinks(ctx context.Context) (*LinkReport, error) {
+	sortByID := bson.D{{Key: "_id", Value: 1}}
+
+	var markers []linkMarker
+	err := query.FindMany(ctx, s.GetCollection("markers"), bson.M{}, &markers,
+		options.Find().SetSort(sortByID).SetProjection(bson.M{"label": 1, "assignedUserIds": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load markers: %w", err)
+	}
+
+	var users []linkUser
+	err = query.FindMany(ctx, s.GetCollection("users"), bson.M{}, &users,
+		options.Find().SetSort(sortByID).SetProjection(bson.M{"assignedMarkers": 1, "building": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+
+	return checkLinks(markers, users), nil
+}
+
+// RepairLinks заново проверяет связи и исправляет найденное одной транзакцией.
+// Возвращает применённые исправления.
+func (s *MarkerService) RepairLinks(ctx context.Context) (*LinkReport, error) {
+	var report *LinkReport
+	err := s.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if report, err = s.CheckLinks(ctx); err != nil {
+			return err
+		}
+		for _, issue := range report.Issues {
+			if err := s.repairLink(ctx, issue); err != nil {
+				return fmt.Errorf("failed to apply %q: %w", issue.Fix(), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *MarkerService) repairLink(ctx context.Context, issue LinkIssue) error {
+	markerCollection := s.GetCollection("markers")
+	userCollection := s.GetCollection("users")
+
+	var err error
+	switch issue.Kind {
+	case LinkIssueMarkerOnly:
+		_, err = userCollection.UpdateOne(ctx, bson.M{"_id": issue.UserID}, bson.M{"$addToSet": bson.M{"assignedMarkers": issue.MarkerID}})
+	case LinkIssueUserOnly:
+		_, err = markerCollection.UpdateOne(ctx, bson.M{"_id": issue.MarkerID}, bson.M{"$addToSet": bson.M{"assignedUserIds": issue.UserID}})
+	case LinkIssueDanglingUser:
+		_, err = markerCollection.UpdateOne(ctx, bson.M{"_id": issue.MarkerID}, bson.M{"$pull": bson.M{"assignedUserIds": issue.UserID}})
+	case LinkIssueDanglingMarker:
+		_, err = userCollection.UpdateOne(ctx, bson.M{"_id": issue.UserID}, bson.M{"$pull": bson.M{"assignedMarkers": issue.MarkerID}})
+	case LinkIssueBuildingMismatch:
+		_, err = userCollection.UpdateOne(ctx, bson.M{"_id": issue.UserID}, bson.M{"$set": bson.M{"building": issue.ExpectedBuilding}})
+	default:
+		err = fmt.Errorf("unknown issue kind %s", issue.Kind)
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckLinks(t *testing.T) {
+	building1 := "Корпус 1"
+	building2 := "Корпус 2"
+	stale := "Старый корпус"
+
+	marker1, marker2, missingMarker := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	consistent, markerOnly, userOnly, dangling, wrongBuilding, missingUser :=
+		primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(),
+		primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	markers := []linkMarker{
+		{ID: marker1, Label: building1, UserIDs: []primitive.ObjectID{consistent, markerOnly, missingUser, wrongBuilding}},
+		{ID: marker2, Label: building2},
+	}
+	users := []linkUser{
+		{ID: consistent, Markers: []primitive.ObjectID{marker1}, Building: &building1},
+		{ID: markerOnly, Building: &building1},
+		{ID: userOnly, Markers: []primitive.ObjectID{marker2}, Building: &building2},
+		{ID: dangling, Markers: []primitive.ObjectID{missingMarker}, Building: &stale},
+		{ID: wrongBuilding, Markers: []primitive.ObjectID{marker1}, Building: &stale},
+	}
+
+	report := checkLinks(markers, users)
+
+	assert.Equal(t, 2, report.MarkersScanned)
+	assert.Equal(t, 5, report.UsersScanned)
+	assert.ElementsMatch(t, []LinkIssue{
+		{Kind: LinkIssueUserOnly, MarkerID: marker2, UserID: userOnly},
+		{Kind: LinkIssueDanglingMarker, MarkerID: missingMarker, UserID: dangling},
+		{Kind: LinkIssueMarkerOnly, MarkerID: marker1, UserID: markerOnly},
+		{Kind: LinkIssueDanglingUser, MarkerID: marker1, UserID: missingUser},
+		{Kind: LinkIssueBuildingMismatch, MarkerID: marker1, UserID: wrongBuilding, Building: &stale, ExpectedBuilding: &building1},
+	}, report.Issues)
+}
+
+func TestCheckLinksBuildingAfterRepair(t *testing.T) {
+	building := "Корпус 3"
+	markerID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// Пользователь без маркеров и без building, но маркер на него ссылается:
+	// после восстановления ссылки building должен стать подписью маркера
+	report := checkLinks(
+		[]linkMarker{{ID: markerID, Label: building, UserIDs: []primitive.ObjectID{userID}}},
+		[]linkUser{{ID: userID}},
+	)
+
+	assert.Equal(t, []LinkIssue{
+		{Kind: LinkIssueMarkerOnly, MarkerID: markerID, UserID: userID},
+		{Kind: LinkIssueBuildingMismatch, MarkerID: markerID, UserID: userID, ExpectedBuilding: &building},
+	}, report.Issues)
+	assert.Equal(t, `~ users[`+userID.Hex()+`].building null -> "Корпус 3"`, report.Issues[1].Fix())
+}
@@ -2,6 +2,7 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
@@ -9,6 +10,8 @@ import (
 	"github.com/DGISsoft/DGISback/services/mongo/query"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MarkerService struct {
@@ -56,17 +59,157 @@ func (s *MarkerService) GetAllMarkers(ctx context.Context) ([]*models.Marker, er
 	return markers, nil
 }
 
+var ErrMarkerConflict = errors.New("marker with this markerId or label already exists")
+
+// MarkerUpdate — изменяемые поля маркера; nil — не менять
+type MarkerUpdate struct {
+	MarkerID *string
+	Label    *string
+	Position []float64
+}
+
+// EnsureMarkerIndexes создаёт уникальные индексы по markerId и label. Если в базе уже есть
+// дубликаты, индекс не создастся — уникальность тогда проверяется только при записи.
+func (s *MarkerService) EnsureMarkerIndexes(ctx context.Context) error {
+	collection := s.GetCollection("markers")
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "markerId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "label", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create marker indexes: %w", err)
+	}
+
+	return nil
+}
+
+// checkMarkerConflict ищет другой маркер (кроме exceptID) с тем же markerId или label
+func (s *MarkerService) checkMarkerConflict(ctx context.Context, exceptID primitive.ObjectID, markerID, label string) error {
+	collection := s.GetCollection("markers")
+
+	count, err := collection.CountDocuments(ctx, bson.M{
+		"_id": bson.M{"$ne": exceptID},
+		"$or": bson.A{bson.M{"markerId": markerID}, bson.M{"label": label}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check marker uniqueness: %w", err)
+	}
+	if count > 0 {
+		return ErrMarkerConflict
+	}
+
+	return nil
+}
+
 func (s *MarkerService) CreateMarker(ctx context.Context, marker *models.Marker) error {
 	collection := s.GetCollection("markers")
 
-	_, err := collection.InsertOne(ctx, marker)
+	if err := s.checkMarkerConflict(ctx, primitive.NilObjectID, marker.MarkerID, marker.Label); err != nil {
+		return err
+	}
+
+	res, err := collection.InsertOne(ctx, bson.M{
+		"markerId":        marker.MarkerID,
+		"position":        marker.Position,
+		"label":           marker.Label,
+		"assignedUserIds": bson.A{},
+	})
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrMarkerConflict
+		}
 		return fmt.Errorf("failed to create marker: %w", err)
 	}
 
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		marker.ID = oid
+	}
+
 	return nil
 }
 
+// UpdateMarker меняет поля маркера. При переименовании новая подпись одной транзакцией
+// записывается в building всех пользователей, у которых стояла старая.
+func (s *MarkerService) UpdateMarker(ctx context.Context, id primitive.ObjectID, update MarkerUpdate) (*models.Marker, error) {
+	var updated *models.Marker
+	err := s.WithTransaction(ctx, func(ctx context.Context) error {
+		marker, err := s.GetMarkerByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		oldLabel := marker.Label
+
+		if update.MarkerID != nil {
+			marker.MarkerID = *update.MarkerID
+		}
+		if update.Label != nil {
+			marker.Label = *update.Label
+		}
+		if update.Position != nil {
+			marker.Position = update.Position
+		}
+
+		if err := s.checkMarkerConflict(ctx, id, marker.MarkerID, marker.Label); err != nil {
+			return err
+		}
+
+		_, err = s.GetCollection("markers").UpdateOne(
+			ctx,
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"markerId": marker.MarkerID, "label": marker.Label, "position": marker.Position}},
+		)
+		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrMarkerConflict
+			}
+			return fmt.Errorf("failed to update marker: %w", err)
+		}
+
+		if marker.Label != oldLabel {
+			result, err := s.GetCollection("users").UpdateMany(
+				ctx,
+				bson.M{"building": oldLabel},
+				bson.M{"$set": bson.M{"building": marker.Label}},
+			)
+			if err != nil {
+				return fmt.Errorf("failed to rename building of users: %w", err)
+			}
+			log.Printf("UpdateMarker: Renamed building '%s' to '%s' for %d users", oldLabel, marker.Label, result.ModifiedCount)
+		}
+
+		updated = marker
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteMarker снимает с маркера всех пользователей и удаляет его одной транзакцией.
+// Возвращает число снятых пользователей.
+func (s *MarkerService) DeleteMarker(ctx context.Context, id primitive.ObjectID) (int, error) {
+	var detached int
+	err := s.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if detached, err = s.clearMarkerUsers(ctx, id); err != nil {
+			return err
+		}
+
+		if _, err := s.GetCollection("markers").DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+			return fmt.Errorf("failed to delete marker: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return detached, nil
+}
+
 type rawMarkerWithUsers struct {
 	ID              primitive.ObjectID   `bson:"_id,omitempty"`
 	MarkerID        string               `bson:"markerId"`
@@ -83,11 +226,17 @@ func (s *MarkerService) GetAllMarkersWithUsers(ctx context.Context) ([]*models.M
 
 	pipeline := []bson.M{
 		{
+			// Деактивированные и удалённые пользователи остаются назначенными, но на карте не показываются
 			"$lookup": bson.M{
-				"from":         "users",
-				"localField":   "assignedUserIds",
-				"foreignField": "_id",
-				"as":           "users",
+				"from": "users",
+				"let":  bson.M{"userIds": bson.M{"$ifNull": bson.A{"$assignedUserIds", bson.A{}}}},
+				"pipeline": bson.A{
+					bson.M{"$match": bson.M{
+						"$expr":  bson.M{"$in": bson.A{"$_id", "$$userIds"}},
+						"status": bson.M{"$nin": bson.A{models.UserStatusDeactivated, models.UserStatusDeleted}},
+					}},
+				},
+				"as": "users",
 			},
 		},
 	}
@@ -113,7 +262,7 @@ func (s *MarkerService) GetAllMarkersWithUsers(ctx context.Context) ([]*models.M
 		}
 
 
-		users := make([]*models.User, len(rawMarker.UsersRaw))
+		users := make([]*models.User, 0, len(rawMarker.UsersRaw))
 		for j, userRaw := range rawMarker.UsersRaw {
 			var user models.User
 
@@ -122,7 +271,7 @@ func (s *MarkerService) GetAllMarkersWithUsers(ctx context.Context) ([]*models.M
 				log.Printf("GetAllMarkersWithUsers: Failed to unmarshal user [%d] for marker [%d] (%s): %v", j, i, rawMarker.ID.Hex(), err)
 				continue
 			}
-			users[j] = &user
+			users = append(users, &user)
 		}
 
 		marker.Users = users
@@ -133,83 +282,84 @@ func (s *MarkerService) GetAllMarkersWithUsers(ctx context.Context) ([]*models.M
 	return resultMarkers, nil
 }
 
+// AssignUserToMarker связывает пользователя с маркером в обе стороны одной транзакцией
 func (s *MarkerService) AssignUserToMarker(ctx context.Context, userID, markerID primitive.ObjectID) error {
+	return s.WithTransaction(ctx, func(ctx context.Context) error {
+		markerCollection := s.GetCollection("markers")
+		var marker struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Label    string             `bson:"label"`
+			MarkerID string             `bson:"markerId"`
+		}
 
-	markerCollection := s.GetCollection("markers")
-	var marker struct {
-		ID       primitive.ObjectID `bson:"_id"`
-		Label    string             `bson:"label"`
-		MarkerID string             `bson:"markerId"`
-	}
-	
-	err := query.FindByID(ctx, markerCollection, markerID, &marker)
-	if err != nil {
-		return fmt.Errorf("failed to get marker: %w", err)
-	}
-
-
-	_, err = markerCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": markerID},
-		bson.M{"$addToSet": bson.M{"assignedUserIds": userID}},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to assign user to marker: %w", err)
-	}
+		err := query.FindByID(ctx, markerCollection, markerID, &marker)
+		if err != nil {
+			return fmt.Errorf("failed to get marker: %w", err)
+		}
 
+		_, err = markerCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": markerID},
+			bson.M{"$addToSet": bson.M{"assignedUserIds": userID}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to assign user to marker: %w", err)
+		}
 
-	userCollection := s.GetCollection("users")
-	_, err = userCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userID},
-		bson.M{
-			"$addToSet": bson.M{"assignedMarkers": markerID},
-			"$set": bson.M{"building": marker.Label},
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to assign marker to user: %w", err)
-	}
+		userCollection := s.GetCollection("users")
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": userID},
+			bson.M{
+				"$addToSet": bson.M{"assignedMarkers": markerID},
+				"$set":      bson.M{"building": marker.Label},
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to assign marker to user: %w", err)
+		}
+		// Без пользователя откатываем и запись в маркере, иначе в нём останется висячая ссылка
+		if result.MatchedCount == 0 {
+			return fmt.Errorf("failed to assign marker to user: user %s not found", userID.Hex())
+		}
 
-	return nil
+		return nil
+	})
 }
 
-
+// RemoveUserFromMarker разрывает связь пользователя с маркером одной транзакцией
 func (s *MarkerService) RemoveUserFromMarker(ctx context.Context, userID, markerID primitive.ObjectID) error {
+	return s.WithTransaction(ctx, func(ctx context.Context) error {
+		markerCollection := s.GetCollection("markers")
+		_, err := markerCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": markerID},
+			bson.M{"$pull": bson.M{"assignedUserIds": userID}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to remove user from marker: %w", err)
+		}
 
-	markerCollection := s.GetCollection("markers")
-	_, err := markerCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": markerID},
-		bson.M{"$pull": bson.M{"assignedUserIds": userID}},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to remove user from marker: %w", err)
-	}
-
+		return s.detachMarkerFromUser(ctx, userID, markerID)
+	})
+}
 
+// detachMarkerFromUser убирает маркер у пользователя и пересчитывает building по оставшимся маркерам.
+// Вызывается внутри транзакции.
+func (s *MarkerService) detachMarkerFromUser(ctx context.Context, userID, markerID primitive.ObjectID) error {
 	var user struct {
 		ID      primitive.ObjectID   `bson:"_id"`
 		Markers []primitive.ObjectID `bson:"assignedMarkers"`
 	}
-	
+
 	userCollection := s.GetCollection("users")
-	err = query.FindByID(ctx, userCollection, userID, &user)
+	err := query.FindByID(ctx, userCollection, userID, &user)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
 
-	_, err = userCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userID},
-		bson.M{"$pull": bson.M{"assignedMarkers": markerID}},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to remove marker from user: %w", err)
-	}
-
 	var newBuilding *string = nil
-	
+
 	remainingMarkers := make([]primitive.ObjectID, 0)
 	for _, mID := range user.Markers {
 		if mID != markerID {
@@ -221,63 +371,72 @@ func (s *MarkerService) RemoveUserFromMarker(ctx context.Context, userID, marker
 		var remainingMarker struct {
 			Label string `bson:"label"`
 		}
-		err = query.FindOne(ctx, markerCollection, bson.M{"_id": remainingMarkers[0]}, &remainingMarker)
+		err = query.FindOne(ctx, s.GetCollection("markers"), bson.M{"_id": remainingMarkers[0]}, &remainingMarker)
 		if err == nil {
 			newBuilding = &remainingMarker.Label
 		}
 	}
 
-	updateFields := bson.M{"building": newBuilding}
 	_, err = userCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": userID},
-		bson.M{"$set": updateFields},
+		bson.M{
+			"$pull": bson.M{"assignedMarkers": markerID},
+			"$set":  bson.M{"building": newBuilding},
+		},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update user building: %w", err)
+		return fmt.Errorf("failed to remove marker from user: %w", err)
 	}
 
 	return nil
 }
 
+// ClearAllUsersFromMarker снимает с маркера всех пользователей одной транзакцией
 func (s *MarkerService) ClearAllUsersFromMarker(ctx context.Context, markerID primitive.ObjectID) error {
-	marker, err := s.GetMarkerByID(ctx, markerID)
-	if err != nil {
+	return s.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.clearMarkerUsers(ctx, markerID)
 		return err
-	}
+	})
+}
 
+// clearMarkerUsers снимает с маркера всех пользователей и возвращает их число. Вызывается внутри транзакции.
+func (s *MarkerService) clearMarkerUsers(ctx context.Context, markerID primitive.ObjectID) (int, error) {
+	markerCollection := s.GetCollection("markers")
+	var marker struct {
+		ID      primitive.ObjectID   `bson:"_id"`
+		UserIDs []primitive.ObjectID `bson:"assignedUserIds"`
+	}
 
-	if len(marker.Users) > 0 {
-		userCollection := s.GetCollection("users")
-		
+	err := query.FindByID(ctx, markerCollection, markerID, &marker)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get marker: %w", err)
+	}
 
-		_, err = userCollection.UpdateMany(
-			ctx,
-			bson.M{"_id": bson.M{"$in": marker.Users}},
-			bson.M{
-				"$pull": bson.M{"assignedMarkers": markerID},
-				"$set":  bson.M{"building": nil},
-			},
-		)
-		if err != nil {
-			return fmt.Errorf("failed to remove marker from users: %w", err)
+	// У пользователя может быть несколько маркеров, поэтому building пересчитывается для каждого
+	detached := 0
+	for _, userID := range marker.UserIDs {
+		if err := s.detachMarkerFromUser(ctx, userID, markerID); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			return detached, err
 		}
+		detached++
 	}
 
-	markerCollection := s.GetCollection("markers")
 	_, err = markerCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": markerID},
 		bson.M{"$set": bson.M{"assignedUserIds": []primitive.ObjectID{}}},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to clear marker users: %w", err)
+		return detached, fmt.Errorf("failed to clear marker users: %w", err)
 	}
 
-	return nil
+	return detached, nil
 }
 
-
 func (s *MarkerService) GetMarkerByLabel(ctx context.Context, label string) (*models.Marker, error) {
 	collection := s.GetCollection("markers")
 	var marker models.Marker
@@ -10,6 +10,7 @@ import (
 	"github.com/DGISsoft/DGISback/models"
 	"github.com/DGISsoft/DGISback/services/mongo/query"
 	"github.com/DGISsoft/DGISback/services/redis"
+	goredis "github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -47,6 +48,25 @@ func (s *NotificationService) CreateNotification(ctx context.Context, notif *mod
 	return nil
 }
 
+// SendSystemNotification отправляет пользователю уведомление от имени системы (без отправителя).
+// Как и sendNotification, идёт через CreateUserNotifications, который публикует изменение
+// счётчика непрочитанных для unreadNotificationsCountChanged.
+func (s *NotificationService) SendSystemNotification(ctx context.Context, userID primitive.ObjectID, title, message string) error {
+	notif := &models.Notification{
+		Type:         models.NotificationTypeSystem,
+		Title:        title,
+		Message:      message,
+		SenderID:     primitive.NilObjectID,
+		RecipientIDs: []primitive.ObjectID{userID},
+	}
+
+	if err := s.CreateNotification(ctx, notif); err != nil {
+		return err
+	}
+
+	return s.CreateUserNotifications(ctx, notif.ID, notif.RecipientIDs, notif.SenderID)
+}
+
 func (s *NotificationService) CreateUserNotifications(ctx context.Context, notificationID primitive.ObjectID, recipientIDs []primitive.ObjectID, senderID primitive.ObjectID) error {
 	if len(recipientIDs) == 0 {
 		log.Printf("NotificationService: No recipients for notification %s, skipping user notification creation", notificationID.Hex())
@@ -238,13 +258,22 @@ func (s *NotificationService) GetUnreadCount(ctx context.Context, userID primiti
 	return int(count), nil
 }
 
+func unreadNotificationsChannel(userID primitive.ObjectID) string {
+	return fmt.Sprintf("unread_notifications_changed:%s", userID.Hex())
+}
+
 // Метод для оповещения подписчиков об изменении уведомлений
 func (s *NotificationService) NotifyUserNotificationChanged(userID primitive.ObjectID) {
 	// Публикуем сообщение в Redis канал
-	channel := fmt.Sprintf("unread_notifications_changed:%s", userID.Hex())
+	channel := unreadNotificationsChannel(userID)
 	
 	// Отправляем сообщение через Redis
 	if err := s.RedisService.Publish(channel, "changed"); err != nil {
 		log.Printf("Failed to publish notification change for user %s: %v", userID.Hex(), err)
 	}
-}
\ No newline at end of file
+}
+
+// Подписка на изменения уведомлений пользователя; вызывающий обязан закрыть PubSub
+func (s *NotificationService) SubscribeUserNotificationChanged(userID primitive.ObjectID) *goredis.PubSub {
+	return s.RedisService.Subscribe(unreadNotificationsChannel(userID))
+}
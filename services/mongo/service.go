@@ -1,11 +1,17 @@
 package mongo
 
 import (
+	"sync/atomic"
+
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type MongoService struct {
 	db *mongo.Database
+	// Выставляется, если сервер не поддерживает транзакции (standalone без replica set)
+	transactionsUnsupported atomic.Bool
+	// Разрешает WithTransaction выполнять изменения без транзакции на таком сервере
+	allowNonTransactional atomic.Bool
 }
 
 func New(db *mongo.Database) *MongoService {
@@ -18,4 +24,9 @@ func (s *MongoService) GetDatabase() *mongo.Database {
 
 func (s *MongoService) GetCollection(name string) *mongo.Collection {
 	return s.db.Collection(name)
-}
\ No newline at end of file
+}
+// AllowNonTransactional разрешает на сервере без replica set выполнять многодокументные изменения
+// без транзакции. Только для локальной разработки: связи маркеров и пользователей перестают быть атомарными.
+func (s *MongoService) AllowNonTransactional(allow bool) {
+	s.allowNonTransactional.Store(allow)
+}
@@ -0,0 +1,127 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxTransactionAttempts = 3
+
+	labelTransientTransaction   = "TransientTransactionError"
+	labelUnknownCommitResult    = "UnknownTransactionCommitResult"
+	errorCodeIllegalOperation   = 20
+	messageTransactionsRequired = "Transaction numbers are only allowed on a replica set member or mongos"
+)
+
+var ErrTransactionsUnsupported = errors.New("mongodb does not support transactions: a replica set is required")
+
+// WithTransaction выполняет fn в транзакции. Все операции внутри fn должны использовать
+// переданный ей ctx. При временных ошибках транзакция повторяется целиком, поэтому fn
+// не должна иметь побочных эффектов вне базы. Если ctx уже принадлежит транзакции,
+// fn выполняется в ней же, так что методы сервисов можно объединять в одну транзакцию.
+//
+// На standalone-сервере без replica set транзакции недоступны: возвращается
+// ErrTransactionsUnsupported, если явно не разрешено AllowNonTransactional.
+func (s *MongoService) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if session := mongo.SessionFromContext(ctx); session != nil {
+		return fn(ctx)
+	}
+	if s.transactionsUnsupported.Load() {
+		return s.withoutTransaction(ctx, fn)
+	}
+
+	session, err := s.db.Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	err = retryTransaction(func() error {
+		return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+			if err := session.StartTransaction(); err != nil {
+				return err
+			}
+			if err := fn(sc); err != nil {
+				if abortErr := session.AbortTransaction(sc); abortErr != nil {
+					log.Printf("WithTransaction: Failed to abort transaction: %v", abortErr)
+				}
+				return err
+			}
+			return retryCommit(func() error { return session.CommitTransaction(sc) })
+		})
+	})
+	if isTransactionsUnsupported(err) {
+		s.transactionsUnsupported.Store(true)
+		return s.withoutTransaction(ctx, fn)
+	}
+	return err
+}
+
+// CheckTransactions проверяет при запуске, что сервер входит в replica set или является mongos.
+// Иначе WithTransaction работать не сможет, и возвращается ErrTransactionsUnsupported,
+// если работа без транзакций не разрешена AllowNonTransactional.
+func (s *MongoService) CheckTransactions(ctx context.Context) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := s.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("failed to query mongodb topology: %w", err)
+	}
+	if hello.SetName != "" || hello.Msg == "isdbgrid" {
+		return nil
+	}
+
+	s.transactionsUnsupported.Store(true)
+	if !s.allowNonTransactional.Load() {
+		return ErrTransactionsUnsupported
+	}
+	log.Printf("CheckTransactions: WARNING - mongodb is not a replica set member, multi-document updates will not be atomic")
+	return nil
+}
+
+func (s *MongoService) withoutTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.allowNonTransactional.Load() {
+		return ErrTransactionsUnsupported
+	}
+	log.Printf("WithTransaction: WARNING - running without a transaction, multi-document updates are not atomic")
+	return fn(ctx)
+}
+
+// retryTransaction повторяет попытку целиком, пока ошибка помечена TransientTransactionError
+func retryTransaction(attempt func() error) error {
+	for i := 1; ; i++ {
+		err := attempt()
+		if err == nil || i >= maxTransactionAttempts || !hasErrorLabel(err, labelTransientTransaction) {
+			return err
+		}
+		log.Printf("WithTransaction: Transient error on attempt %d, retrying: %v", i, err)
+	}
+}
+
+// retryCommit повторяет только фиксацию, пока её результат неизвестен
+func retryCommit(commit func() error) error {
+	for i := 1; ; i++ {
+		err := commit()
+		if err == nil || i >= maxTransactionAttempts || !hasErrorLabel(err, labelUnknownCommitResult) {
+			return err
+		}
+		log.Printf("WithTransaction: Unknown commit result on attempt %d, retrying commit: %v", i, err)
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
+
+func isTransactionsUnsupported(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCodeWithMessage(errorCodeIllegalOperation, messageTransactionsRequired)
+}
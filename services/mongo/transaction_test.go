@@ -0,0 +1,81 @@
+package mongo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestHasErrorLabel(t *testing.T) {
+	transient := mongo.CommandError{Code: 251, Message: "NoSuchTransaction", Labels: []string{labelTransientTransaction}}
+
+	assert.True(t, hasErrorLabel(transient, labelTransientTransaction))
+	assert.True(t, hasErrorLabel(fmt.Errorf("failed to assign user to marker: %w", transient), labelTransientTransaction))
+	assert.False(t, hasErrorLabel(transient, labelUnknownCommitResult))
+	assert.False(t, hasErrorLabel(errMongoDown, labelTransientTransaction))
+}
+
+func TestIsTransactionsUnsupported(t *testing.T) {
+	standalone := mongo.CommandError{Code: errorCodeIllegalOperation, Message: messageTransactionsRequired}
+
+	assert.True(t, isTransactionsUnsupported(standalone))
+	assert.False(t, isTransactionsUnsupported(mongo.CommandError{Code: errorCodeIllegalOperation, Message: "other"}))
+	assert.False(t, isTransactionsUnsupported(errMongoDown))
+}
+
+func TestRetryTransaction(t *testing.T) {
+	transient := mongo.CommandError{Code: 112, Message: "WriteConflict", Labels: []string{labelTransientTransaction}}
+
+	attempts := 0
+	err := retryTransaction(func() error {
+		attempts++
+		if attempts < 2 {
+			return transient
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts, "transient error must be retried")
+
+	attempts = 0
+	err = retryTransaction(func() error {
+		attempts++
+		return transient
+	})
+	assert.Equal(t, transient, err)
+	assert.Equal(t, maxTransactionAttempts, attempts, "retries must stop after maxTransactionAttempts")
+
+	attempts = 0
+	err = retryTransaction(func() error {
+		attempts++
+		return errMongoDown
+	})
+	assert.ErrorIs(t, err, errMongoDown)
+	assert.Equal(t, 1, attempts, "non-transient error must not be retried")
+}
+
+func TestRetryCommit(t *testing.T) {
+	unknown := mongo.CommandError{Code: 91, Message: "ShutdownInProgress", Labels: []string{labelUnknownCommitResult}}
+
+	commits := 0
+	err := retryCommit(func() error {
+		commits++
+		if commits < maxTransactionAttempts {
+			return unknown
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, maxTransactionAttempts, commits)
+
+	// Временная ошибка транзакции при фиксации повторяется всей транзакцией, а не только фиксацией
+	commits = 0
+	err = retryCommit(func() error {
+		commits++
+		return mongo.CommandError{Code: 251, Labels: []string{labelTransientTransaction}}
+	})
+	assert.True(t, hasErrorLabel(err, labelTransientTransaction))
+	assert.Equal(t, 1, commits)
+}
@@ -0,0 +1,159 @@
+// services/mongo/user_cascade.go
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DGISsoft/DGISback/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeletedSenderName подставляется вместо отправителя в уведомлениях окончательно удалённого пользователя
+const DeletedSenderName = "Удалённый пользователь"
+
+var ErrUserNotDeleted = errors.New("user is not marked as deleted")
+
+// UserCascadeStore — шаги окончательного удаления пользователя. Шаги выполняются в одной
+// транзакции и идемпотентны, поэтому прерванное удаление можно просто повторить.
+type UserCascadeStore interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	DetachUserFromMarkers(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	DeleteUserInbox(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	AnonymizeUserNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	// Удаляет документ, только если пользователь уже помечен DELETED
+	DeleteUserDocument(ctx context.Context, userID primitive.ObjectID) (bool, error)
+}
+
+// DeleteUserResult — что затронуло окончательное удаление пользователя
+type DeleteUserResult struct {
+	MarkersDetached         int64
+	InboxRemoved            int64
+	NotificationsAnonymized int64
+	UserDeleted             bool
+}
+
+// CascadeDeleteUser удаляет пользователя вместе со ссылками на него одной транзакцией.
+// Если какой-то шаг упал или пользователя успели восстановить (ErrUserNotDeleted),
+// не меняется ничего.
+func CascadeDeleteUser(ctx context.Context, store UserCascadeStore, userID primitive.ObjectID) (*DeleteUserResult, error) {
+	var result *DeleteUserResult
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		// При повторе транзакции счётчики считаются заново
+		result = &DeleteUserResult{}
+		var err error
+
+		if result.MarkersDetached, err = store.DetachUserFromMarkers(ctx, userID); err != nil {
+			return fmt.Errorf("failed to detach user from markers: %w", err)
+		}
+		if result.InboxRemoved, err = store.DeleteUserInbox(ctx, userID); err != nil {
+			return fmt.Errorf("failed to delete user inbox: %w", err)
+		}
+		if result.NotificationsAnonymized, err = store.AnonymizeUserNotifications(ctx, userID); err != nil {
+			return fmt.Errorf("failed to anonymize user notifications: %w", err)
+		}
+		if result.UserDeleted, err = store.DeleteUserDocument(ctx, userID); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		if !result.UserDeleted {
+			return ErrUserNotDeleted
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// UserCascade — реализация UserCascadeStore поверх коллекций Mongo
+type UserCascade struct {
+	*MongoService
+}
+
+func NewUserCascade(mongoService *MongoService) *UserCascade {
+	return &UserCascade{MongoService: mongoService}
+}
+
+// DetachUserFromMarkers снимает пользователя со всех маркеров одной транзакцией с обеих сторон связи
+func (s *UserCascade) DetachUserFromMarkers(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	var detached int64
+	err := s.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := s.GetCollection("markers").UpdateMany(
+			ctx,
+			bson.M{"assignedUserIds": userID},
+			bson.M{"$pull": bson.M{"assignedUserIds": userID}},
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.GetCollection("users").UpdateOne(
+			ctx,
+			bson.M{"_id": userID},
+			bson.M{"$set": bson.M{"assignedMarkers": []primitive.ObjectID{}, "building": nil}},
+		)
+		if err != nil {
+			return err
+		}
+
+		detached = result.ModifiedCount
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return detached, nil
+}
+
+func (s *UserCascade) DeleteUserInbox(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	collection := s.GetCollection("user_notifications")
+
+	result, err := collection.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// AnonymizeUserNotifications отвязывает от пользователя отправленные им уведомления
+// и убирает его из списков получателей
+func (s *UserCascade) AnonymizeUserNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	collection := s.GetCollection("notifications")
+
+	sent, err := collection.UpdateMany(
+		ctx,
+		bson.M{"senderId": userID},
+		bson.M{"$set": bson.M{"senderId": primitive.NilObjectID, "senderName": DeletedSenderName}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	received, err := collection.UpdateMany(
+		ctx,
+		bson.M{"recipientIds": userID},
+		bson.M{"$pull": bson.M{"recipientIds": userID}},
+	)
+	if err != nil {
+		return sent.ModifiedCount, err
+	}
+
+	return sent.ModifiedCount + received.ModifiedCount, nil
+}
+
+func (s *UserCascade) DeleteUserDocument(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	collection := s.GetCollection("users")
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": userID, "status": models.UserStatusDeleted})
+	if err != nil {
+		return false, err
+	}
+
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,191 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testMongoService подключается к MONGO_TEST_URI (по умолчанию локальный replica set rs0) и создаёт
+// отдельную базу на каждый тест. Без MongoDB с поддержкой транзакций тест пропускается.
+func testMongoService(t *testing.T) *MongoService {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		uri = "mongodb://localhost:27017/?replicaSet=rs0"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Skipf("MongoDB is not available: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Skipf("MongoDB is not available at %s: %v", uri, err)
+	}
+
+	db := client.Database("dgis-test-" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() { db.Drop(context.Background()) })
+
+	service := New(db)
+	if err := service.CheckTransactions(ctx); err != nil {
+		t.Skipf("MongoDB at %s cannot run transactions: %v", uri, err)
+	}
+	return service
+}
+
+// failingCascade выполняет настоящие шаги UserCascade и падает на шаге failAt, когда предыдущие
+// шаги уже записали свои изменения в транзакцию
+type failingCascade struct {
+	*UserCascade
+	failAt string
+}
+
+func (s *failingCascade) DeleteUserInbox(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	if s.failAt == "inbox" {
+		return 0, errMongoDown
+	}
+	return s.UserCascade.DeleteUserInbox(ctx, userID)
+}
+
+func (s *failingCascade) AnonymizeUserNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	if s.failAt == "notifications" {
+		return 0, errMongoDown
+	}
+	return s.UserCascade.AnonymizeUserNotifications(ctx, userID)
+}
+
+func (s *failingCascade) DeleteUserDocument(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	if s.failAt == "user" {
+		return false, errMongoDown
+	}
+	return s.UserCascade.DeleteUserDocument(ctx, userID)
+}
+
+type cascadeFixture struct {
+	userID, otherID, markerID, notificationID primitive.ObjectID
+}
+
+func insertCascadeFixture(t *testing.T, service *MongoService) cascadeFixture {
+	t.Helper()
+	ctx := context.Background()
+	f := cascadeFixture{
+		userID:         primitive.NewObjectID(),
+		otherID:        primitive.NewObjectID(),
+		markerID:       primitive.NewObjectID(),
+		notificationID: primitive.NewObjectID(),
+	}
+
+	_, err := service.GetCollection("users").InsertOne(ctx, bson.M{
+		"_id": f.userID, "login": "deleted-user", "status": models.UserStatusDeleted,
+		"building": "6.1", "assignedMarkers": bson.A{f.markerID},
+	})
+	require.NoError(t, err)
+	_, err = service.GetCollection("markers").InsertOne(ctx, bson.M{
+		"_id": f.markerID, "label": "6.1", "assignedUserIds": bson.A{f.userID, f.otherID},
+	})
+	require.NoError(t, err)
+	_, err = service.GetCollection("user_notifications").InsertMany(ctx, []any{
+		bson.M{"userId": f.userID}, bson.M{"userId": f.userID}, bson.M{"userId": f.otherID},
+	})
+	require.NoError(t, err)
+	_, err = service.GetCollection("notifications").InsertOne(ctx, bson.M{
+		"_id": f.notificationID, "senderId": f.userID, "senderName": "Иван Петров", "recipientIds": bson.A{f.otherID},
+	})
+	require.NoError(t, err)
+	return f
+}
+
+// assertCascadeUntouched проверяет, что ни одна запись шагов до сбоя не пережила откат транзакции
+func assertCascadeUntouched(t *testing.T, service *MongoService, f cascadeFixture) {
+	t.Helper()
+	ctx := context.Background()
+
+	var user struct {
+		AssignedMarkers []primitive.ObjectID `bson:"assignedMarkers"`
+		Building        *string              `bson:"building"`
+	}
+	require.NoError(t, service.GetCollection("users").FindOne(ctx, bson.M{"_id": f.userID}).Decode(&user))
+	assert.Equal(t, []primitive.ObjectID{f.markerID}, user.AssignedMarkers)
+	if assert.NotNil(t, user.Building) {
+		assert.Equal(t, "6.1", *user.Building)
+	}
+
+	var marker struct {
+		AssignedUserIDs []primitive.ObjectID `bson:"assignedUserIds"`
+	}
+	require.NoError(t, service.GetCollection("markers").FindOne(ctx, bson.M{"_id": f.markerID}).Decode(&marker))
+	assert.Equal(t, []primitive.ObjectID{f.userID, f.otherID}, marker.AssignedUserIDs)
+
+	inbox, err := service.GetCollection("user_notifications").CountDocuments(ctx, bson.M{"userId": f.userID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), inbox)
+
+	var notification struct {
+		SenderID primitive.ObjectID `bson:"senderId"`
+	}
+	require.NoError(t, service.GetCollection("notifications").FindOne(ctx, bson.M{"_id": f.notificationID}).Decode(&notification))
+	assert.Equal(t, f.userID, notification.SenderID)
+}
+
+func TestUserCascadeRollsBackOnMongo(t *testing.T) {
+	service := testMongoService(t)
+
+	for _, failAt := range []string{"inbox", "notifications", "user"} {
+		t.Run(failAt, func(t *testing.T) {
+			f := insertCascadeFixture(t, service)
+
+			result, err := CascadeDeleteUser(context.Background(), &failingCascade{UserCascade: NewUserCascade(service), failAt: failAt}, f.userID)
+
+			assert.ErrorIs(t, err, errMongoDown)
+			assert.Nil(t, result)
+			assertCascadeUntouched(t, service, f)
+		})
+	}
+}
+
+func TestUserCascadeDeletesOnMongo(t *testing.T) {
+	service := testMongoService(t)
+	ctx := context.Background()
+	f := insertCascadeFixture(t, service)
+
+	result, err := CascadeDeleteUser(ctx, NewUserCascade(service), f.userID)
+
+	require.NoError(t, err)
+	assert.Equal(t, &DeleteUserResult{MarkersDetached: 1, InboxRemoved: 2, NotificationsAnonymized: 1, UserDeleted: true}, result)
+
+	users, err := service.GetCollection("users").CountDocuments(ctx, bson.M{"_id": f.userID})
+	require.NoError(t, err)
+	assert.Zero(t, users)
+
+	var marker struct {
+		AssignedUserIDs []primitive.ObjectID `bson:"assignedUserIds"`
+	}
+	require.NoError(t, service.GetCollection("markers").FindOne(ctx, bson.M{"_id": f.markerID}).Decode(&marker))
+	assert.Equal(t, []primitive.ObjectID{f.otherID}, marker.AssignedUserIDs)
+
+	inbox, err := service.GetCollection("user_notifications").CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), inbox, "only the other user's inbox must remain")
+
+	var notification struct {
+		SenderID   primitive.ObjectID `bson:"senderId"`
+		SenderName string             `bson:"senderName"`
+	}
+	require.NoError(t, service.GetCollection("notifications").FindOne(ctx, bson.M{"_id": f.notificationID}).Decode(&notification))
+	assert.True(t, notification.SenderID.IsZero())
+	assert.Equal(t, DeletedSenderName, notification.SenderName)
+}
@@ -0,0 +1,107 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errMongoDown = errors.New("connection reset by peer")
+
+// fakeCascadeStore хранит ссылки на одного пользователя и падает на шаге failAt
+type fakeCascadeStore struct {
+	markers       int64
+	inbox         int64
+	notifications int64
+	userExists    bool
+	failAt        string
+}
+
+func (s *fakeCascadeStore) step(name string, count *int64) (int64, error) {
+	if s.failAt == name {
+		return 0, errMongoDown
+	}
+	n := *count
+	*count = 0
+	return n, nil
+}
+
+// WithTransaction откатывает состояние, если fn вернула ошибку
+func (s *fakeCascadeStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	snapshot := *s
+	if err := fn(ctx); err != nil {
+		failAt := s.failAt
+		*s = snapshot
+		s.failAt = failAt
+		return err
+	}
+	return nil
+}
+
+func (s *fakeCascadeStore) DetachUserFromMarkers(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.step("markers", &s.markers)
+}
+
+func (s *fakeCascadeStore) DeleteUserInbox(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.step("inbox", &s.inbox)
+}
+
+func (s *fakeCascadeStore) AnonymizeUserNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return s.step("notifications", &s.notifications)
+}
+
+func (s *fakeCascadeStore) DeleteUserDocument(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	if s.failAt == "user" {
+		return false, errMongoDown
+	}
+	deleted := s.userExists
+	s.userExists = false
+	return deleted, nil
+}
+
+func TestCascadeDeleteUser(t *testing.T) {
+	store := &fakeCascadeStore{markers: 2, inbox: 5, notifications: 3, userExists: true}
+
+	result, err := CascadeDeleteUser(context.Background(), store, primitive.NewObjectID())
+
+	assert.NoError(t, err)
+	assert.Equal(t, &DeleteUserResult{MarkersDetached: 2, InboxRemoved: 5, NotificationsAnonymized: 3, UserDeleted: true}, result)
+}
+
+func TestCascadeDeleteUserFailsHalfway(t *testing.T) {
+	for _, failAt := range []string{"markers", "inbox", "notifications", "user"} {
+		t.Run(failAt, func(t *testing.T) {
+			store := &fakeCascadeStore{markers: 2, inbox: 5, notifications: 3, userExists: true, failAt: failAt}
+			userID := primitive.NewObjectID()
+
+			result, err := CascadeDeleteUser(context.Background(), store, userID)
+
+			assert.ErrorIs(t, err, errMongoDown)
+			assert.Nil(t, result)
+			// Транзакция откатилась целиком: ссылки и пользователь на месте
+			assert.True(t, store.userExists)
+			assert.Equal(t, int64(10), store.markers+store.inbox+store.notifications)
+
+			store.failAt = ""
+			retry, err := CascadeDeleteUser(context.Background(), store, userID)
+
+			assert.NoError(t, err)
+			assert.Equal(t, &DeleteUserResult{MarkersDetached: 2, InboxRemoved: 5, NotificationsAnonymized: 3, UserDeleted: true}, retry)
+			assert.Zero(t, store.markers+store.inbox+store.notifications)
+		})
+	}
+}
+
+func TestCascadeDeleteUserRestoredConcurrently(t *testing.T) {
+	// Пользователя восстановили между выборкой и удалением: документ не удаляется
+	store := &fakeCascadeStore{markers: 2, inbox: 5, notifications: 3, userExists: false}
+
+	result, err := CascadeDeleteUser(context.Background(), store, primitive.NewObjectID())
+
+	assert.ErrorIs(t, err, ErrUserNotDeleted)
+	assert.Nil(t, result)
+	assert.Equal(t, int64(10), store.markers+store.inbox+store.notifications, "inbox and links must survive")
+}
@@ -0,0 +1,187 @@
+// services/mongo/user_list.go
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/DGISsoft/DGISback/services/mongo/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidUserCursor       = errors.New("invalid cursor")
+	ErrUserCursorOrderMismatch = errors.New("cursor was issued for a different orderBy")
+)
+
+type UserOrderField string
+
+const (
+	UserOrderByFullName  UserOrderField = "full_name"
+	UserOrderByLogin     UserOrderField = "login"
+	UserOrderByCreatedAt UserOrderField = "created_at"
+)
+
+type UserOrder struct {
+	Field      UserOrderField
+	Descending bool
+}
+
+type UserFilter struct {
+	// Пустой список — без ограничения по ролям
+	Roles []models.UserRole
+	// Пустой список — без ограничения по статусам
+	Statuses []models.UserStatus
+	Building *string
+	MarkerID *primitive.ObjectID
+	// Подстрока ФИО или логина без учёта регистра
+	Search string
+}
+
+// UserCursor — значение поля сортировки и _id последнего пользователя страницы;
+// _id разрешает совпадения значений поля. Поле и направление сортировки хранятся в курсоре,
+// чтобы курсор нельзя было применить к списку с другим orderBy.
+type UserCursor struct {
+	Field      UserOrderField     `bson:"f"`
+	Descending bool               `bson:"d,omitempty"`
+	Value      any                `bson:"v"`
+	ID         primitive.ObjectID `bson:"id"`
+}
+
+func NewUserCursor(user *models.User, order UserOrder) *UserCursor {
+	cursor := &UserCursor{Field: UserOrderField(order.field()), Descending: order.Descending, ID: user.ID}
+	switch cursor.Field {
+	case UserOrderByLogin:
+		cursor.Value = user.Login
+	case UserOrderByCreatedAt:
+		cursor.Value = user.CreatedAt
+	default:
+		cursor.Value = user.FullName
+	}
+	return cursor
+}
+
+func (c *UserCursor) Encode() string {
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeUserCursor разбирает курсор и проверяет, что он выдан для того же порядка order
+func DecodeUserCursor(s string, order UserOrder) (*UserCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidUserCursor
+	}
+
+	var cursor UserCursor
+	if err := bson.Unmarshal(data, &cursor); err != nil || cursor.ID.IsZero() {
+		return nil, ErrInvalidUserCursor
+	}
+	if cursor.Field != UserOrderField(order.field()) || cursor.Descending != order.Descending {
+		return nil, ErrUserCursorOrderMismatch
+	}
+	return &cursor, nil
+}
+
+func (f UserFilter) conditions() bson.A {
+	conditions := bson.A{}
+	if len(f.Roles) > 0 {
+		conditions = append(conditions, bson.M{"role": bson.M{"$in": f.Roles}})
+	}
+	if len(f.Statuses) > 0 {
+		conditions = append(conditions, bson.M{"status": statusFilter(f.Statuses)})
+	}
+	if f.Building != nil {
+		conditions = append(conditions, bson.M{"building": *f.Building})
+	}
+	if f.MarkerID != nil {
+		conditions = append(conditions, bson.M{"assignedMarkers": *f.MarkerID})
+	}
+	if f.Search != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(f.Search), Options: "i"}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"full_name": pattern},
+			bson.M{"login": pattern},
+		}})
+	}
+	return conditions
+}
+
+// statusFilter учитывает, что у пользователей, созданных до появления статусов, поля status нет
+func statusFilter(statuses []models.UserStatus) bson.M {
+	values := bson.A{}
+	for _, status := range statuses {
+		values = append(values, status)
+		if status == models.UserStatusActive {
+			values = append(values, nil)
+		}
+	}
+	return bson.M{"$in": values}
+}
+
+func andFilter(conditions bson.A) bson.M {
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": conditions}
+}
+
+func (o UserOrder) field() string {
+	switch o.Field {
+	case UserOrderByLogin, UserOrderByCreatedAt:
+		return string(o.Field)
+	default:
+		return string(UserOrderByFullName)
+	}
+}
+
+// FindUsers возвращает страницу пользователей после курсора after в порядке order
+func (s *UserService) FindUsers(ctx context.Context, filter UserFilter, order UserOrder, after *UserCursor, limit int64) ([]*models.User, error) {
+	collection := s.GetCollection("users")
+
+	field := order.field()
+	direction, comparison := 1, "$gt"
+	if order.Descending {
+		direction, comparison = -1, "$lt"
+	}
+
+	conditions := filter.conditions()
+	if after != nil {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{field: bson.M{comparison: after.Value}},
+			bson.M{field: after.Value, "_id": bson.M{comparison: after.ID}},
+		}})
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(limit)
+
+	var users []*models.User
+	err := query.FindMany(ctx, collection, andFilter(conditions), &users, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *UserService) CountUsers(ctx context.Context, filter UserFilter) (int64, error) {
+	collection := s.GetCollection("users")
+
+	count, err := collection.CountDocuments(ctx, andFilter(filter.conditions()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,57 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	user := &models.User{
+		ID:        primitive.NewObjectID(),
+		Login:     "ivanov",
+		FullName:  "Иванов Иван",
+		CreatedAt: time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		order UserOrder
+		value any
+	}{
+		{UserOrder{}, "Иванов Иван"},
+		{UserOrder{Field: UserOrderByLogin, Descending: true}, "ivanov"},
+		{UserOrder{Field: UserOrderByCreatedAt}, primitive.NewDateTimeFromTime(user.CreatedAt)},
+	}
+	for _, tt := range tests {
+		cursor, err := DecodeUserCursor(NewUserCursor(user, tt.order).Encode(), tt.order)
+		if assert.NoError(t, err, "order %+v", tt.order) {
+			assert.Equal(t, user.ID, cursor.ID)
+			assert.Equal(t, tt.value, cursor.Value)
+		}
+	}
+}
+
+func TestDecodeUserCursorRejectsOtherOrder(t *testing.T) {
+	user := &models.User{ID: primitive.NewObjectID(), Login: "ivanov", FullName: "Иванов Иван"}
+	encoded := NewUserCursor(user, UserOrder{Field: UserOrderByLogin}).Encode()
+
+	_, err := DecodeUserCursor(encoded, UserOrder{Field: UserOrderByFullName})
+	assert.Equal(t, ErrUserCursorOrderMismatch, err)
+
+	_, err = DecodeUserCursor(encoded, UserOrder{Field: UserOrderByLogin, Descending: true})
+	assert.Equal(t, ErrUserCursorOrderMismatch, err)
+
+	// Пустое поле сортировки означает сортировку по ФИО
+	_, err = DecodeUserCursor(NewUserCursor(user, UserOrder{}).Encode(), UserOrder{Field: UserOrderByFullName})
+	assert.NoError(t, err)
+}
+
+func TestDecodeUserCursorInvalid(t *testing.T) {
+	for _, encoded := range []string{"", "not base64!", "aGVsbG8"} {
+		_, err := DecodeUserCursor(encoded, UserOrder{})
+		assert.Equal(t, ErrInvalidUserCursor, err, "cursor %q", encoded)
+	}
+}
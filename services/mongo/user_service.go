@@ -3,8 +3,11 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/DGISsoft/DGISback/models"
@@ -12,6 +15,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -70,14 +74,37 @@ func (s *UserService) GetUsers(ctx context.Context) ([]*models.User, error) {
     return users, nil
 }
 
-func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
+// ExistingLogins возвращает те логины из списка, которые уже заняты
+func (s *UserService) ExistingLogins(ctx context.Context, logins []string) ([]string, error) {
     collection := s.GetCollection("users")
 
-    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+    var users []struct {
+        Login string `bson:"login"`
+    }
+    opts := options.Find().SetProjection(bson.M{"login": 1})
+    err := query.FindMany(ctx, collection, bson.M{"login": bson.M{"$in": logins}}, &users, opts)
     if err != nil {
-        return fmt.Errorf("failed to hash password: %w", err)
+        return nil, fmt.Errorf("failed to check existing logins: %w", err)
+    }
+
+    existing := make([]string, 0, len(users))
+    for _, user := range users {
+        existing = append(existing, user.Login)
+    }
+    return existing, nil
+}
+
+func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
+    collection := s.GetCollection("users")
+
+    // У приглашённого пользователя пароля нет до принятия приглашения
+    if user.Password != "" {
+        hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+        if err != nil {
+            return fmt.Errorf("failed to hash password: %w", err)
+        }
+        user.Password = string(hashedPassword)
     }
-    user.Password = string(hashedPassword)
 
     now := time.Now()
     user.CreatedAt = now
@@ -98,6 +125,8 @@ func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
     return nil
 }
 
+// UpdateUser записывает поля из updateData. При смене telegram_tag привязка к Telegram снимается:
+// она подтверждалась для прежнего аккаунта.
 func (s *UserService) UpdateUser(ctx context.Context, id primitive.ObjectID, updateData bson.M) error {
     collection := s.GetCollection("users")
 
@@ -105,6 +134,9 @@ func (s *UserService) UpdateUser(ctx context.Context, id primitive.ObjectID, upd
         "$set":         updateData,
         "$currentDate": bson.M{"updated_at": true},
     }
+    if _, ok := updateData["telegram_tag"]; ok {
+        updateQuery["$unset"] = bson.M{"telegram_id": ""}
+    }
 
     _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, updateQuery)
     if err != nil {
@@ -125,6 +157,278 @@ func (s *UserService) DeleteUser(ctx context.Context, id primitive.ObjectID) err
     return nil
 }
 
+var ErrUserStatusConflict = errors.New("user not found or in a status that does not allow this change")
+
+// SetUserStatus переводит пользователя из одного из статусов from в status и отмечает время перехода
+func (s *UserService) SetUserStatus(ctx context.Context, id primitive.ObjectID, status models.UserStatus, from ...models.UserStatus) error {
+    collection := s.GetCollection("users")
+
+    now := time.Now()
+    set := bson.M{"status": status}
+    unset := bson.M{}
+    switch status {
+    case models.UserStatusDeactivated:
+        set["deactivated_at"] = now
+        unset["deleted_at"] = ""
+    case models.UserStatusDeleted:
+        set["deleted_at"] = now
+    default:
+        unset["deactivated_at"] = ""
+        unset["deleted_at"] = ""
+    }
+
+    update := bson.M{
+        "$set":         set,
+        "$currentDate": bson.M{"updated_at": true},
+    }
+    if len(unset) > 0 {
+        update["$unset"] = unset
+    }
+
+    filter := bson.M{"_id": id}
+    if len(from) > 0 {
+        filter["status"] = statusFilter(from)
+    }
+
+    result, err := collection.UpdateOne(ctx, filter, update)
+    if err != nil {
+        return fmt.Errorf("failed to update user status: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return ErrUserStatusConflict
+    }
+
+    return nil
+}
+
+// GetUsersDeletedBefore возвращает удалённых пользователей, срок восстановления которых истёк
+func (s *UserService) GetUsersDeletedBefore(ctx context.Context, cutoff time.Time) ([]*models.User, error) {
+    collection := s.GetCollection("users")
+
+    var users []*models.User
+    filter := bson.M{"status": models.UserStatusDeleted, "deleted_at": bson.M{"$lt": cutoff}}
+    err := query.FindMany(ctx, collection, filter, &users)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get deleted users: %w", err)
+    }
+
+    return users, nil
+}
+
+func (s *UserService) SetLockedUntil(ctx context.Context, id primitive.ObjectID, lockedUntil *time.Time) error {
+    return s.UpdateUser(ctx, id, bson.M{"locked_until": lockedUntil})
+}
+
+func (s *UserService) SetPendingTOTPSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+    return s.UpdateUser(ctx, id, bson.M{"totp_pending_secret": secret})
+}
+
+// EnableTOTP переносит подтверждённый секрет в рабочий и сохраняет хэши кодов восстановления
+func (s *UserService) EnableTOTP(ctx context.Context, id primitive.ObjectID, secret string, recoveryCodeHashes []string) error {
+    collection := s.GetCollection("users")
+
+    _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+        "$set": bson.M{
+            "totp_enabled":   true,
+            "totp_secret":    secret,
+            "recovery_codes": recoveryCodeHashes,
+        },
+        "$unset":       bson.M{"totp_pending_secret": ""},
+        "$currentDate": bson.M{"updated_at": true},
+    })
+    if err != nil {
+        return fmt.Errorf("failed to enable totp: %w", err)
+    }
+
+    return nil
+}
+
+func (s *UserService) DisableTOTP(ctx context.Context, id primitive.ObjectID) error {
+    collection := s.GetCollection("users")
+
+    _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+        "$set":         bson.M{"totp_enabled": false},
+        "$unset":       bson.M{"totp_secret": "", "totp_pending_secret": "", "recovery_codes": ""},
+        "$currentDate": bson.M{"updated_at": true},
+    })
+    if err != nil {
+        return fmt.Errorf("failed to disable totp: %w", err)
+    }
+
+    return nil
+}
+
+func (s *UserService) SetRecoveryCodes(ctx context.Context, id primitive.ObjectID, recoveryCodeHashes []string) error {
+    return s.UpdateUser(ctx, id, bson.M{"recovery_codes": recoveryCodeHashes})
+}
+
+// UseRecoveryCode атомарно погашает код восстановления; false — кода нет или он уже использован
+func (s *UserService) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error) {
+    collection := s.GetCollection("users")
+
+    result, err := collection.UpdateOne(
+        ctx,
+        bson.M{"_id": id, "recovery_codes": codeHash},
+        bson.M{"$pull": bson.M{"recovery_codes": codeHash}},
+    )
+    if err != nil {
+        return false, fmt.Errorf("failed to use recovery code: %w", err)
+    }
+
+    return result.ModifiedCount == 1, nil
+}
+
+func (s *UserService) GetUserByTelegramID(ctx context.Context, telegramID string) (*models.User, error) {
+    collection := s.GetCollection("users")
+
+    var user models.User
+    err := query.FindOne(ctx, collection, bson.M{"telegram_id": telegramID}, &user)
+    if err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, fmt.Errorf("user not found")
+        }
+        return nil, fmt.Errorf("failed to get user: %w", err)
+    }
+
+    return &user, nil
+}
+
+var (
+    ErrTelegramAlreadyLinked = errors.New("telegram account is already linked")
+    ErrLoginTaken            = errors.New("login is already taken")
+)
+
+// EnsureUserIndexes создаёт уникальные индексы по login и telegram_id. У приглашённых пользователей
+// логина ещё нет, поэтому пустой login в индекс не попадает.
+func (s *UserService) EnsureUserIndexes(ctx context.Context) error {
+    collection := s.GetCollection("users")
+
+    _, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "login", Value: 1}},
+            Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"login": bson.M{"$gt": ""}}),
+        },
+        {
+            Keys:    bson.D{{Key: "telegram_id", Value: 1}},
+            Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"telegram_id": bson.M{"$type": "string"}}),
+        },
+    })
+    if err != nil {
+        return fmt.Errorf("failed to create user indexes: %w", err)
+    }
+
+    return nil
+}
+
+// LinkTelegramID привязывает telegramID к пользователю id, если Telegram у него ещё не привязан.
+// Вызывается только из сессии самого пользователя: совпадение username с telegram_tag без неё ничего не доказывает.
+func (s *UserService) LinkTelegramID(ctx context.Context, id primitive.ObjectID, telegramID string) error {
+    collection := s.GetCollection("users")
+
+    count, err := collection.CountDocuments(ctx, bson.M{"telegram_id": telegramID, "_id": bson.M{"$ne": id}})
+    if err != nil {
+        return fmt.Errorf("failed to check telegram account: %w", err)
+    }
+    if count > 0 {
+        return ErrTelegramAlreadyLinked
+    }
+
+    result, err := collection.UpdateOne(ctx,
+        bson.M{
+            "_id":         id,
+            "status":      bson.M{"$nin": bson.A{models.UserStatusPending, models.UserStatusDeactivated, models.UserStatusDeleted}},
+            "telegram_id": bson.M{"$exists": false},
+        },
+        bson.M{
+            "$set":         bson.M{"telegram_id": telegramID},
+            "$currentDate": bson.M{"updated_at": true},
+        },
+    )
+    if err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            return ErrTelegramAlreadyLinked
+        }
+        return fmt.Errorf("failed to link telegram account: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        linked, err := query.Exists(ctx, collection, bson.M{"_id": id, "telegram_id": bson.M{"$exists": true}})
+        if err != nil {
+            return fmt.Errorf("failed to check telegram account: %w", err)
+        }
+        if linked {
+            return ErrTelegramAlreadyLinked
+        }
+        return ErrUserStatusConflict
+    }
+
+    return nil
+}
+
+// TelegramTagTaken проверяет, указан ли тег у другого неудалённого пользователя. Username в Telegram
+// регистронезависим, поэтому @Ivanov и @ivanov считаются одним тегом.
+func (s *UserService) TelegramTagTaken(ctx context.Context, tag string, exceptID primitive.ObjectID) (bool, error) {
+    collection := s.GetCollection("users")
+
+    username := strings.TrimPrefix(tag, "@")
+    filter := bson.M{
+        "telegram_tag": primitive.Regex{Pattern: "^@?" + regexp.QuoteMeta(username) + "$", Options: "i"},
+        "_id":          bson.M{"$ne": exceptID},
+        "status":       bson.M{"$ne": models.UserStatusDeleted},
+    }
+    taken, err := query.Exists(ctx, collection, filter)
+    if err != nil {
+        return false, fmt.Errorf("failed to check telegram tag: %w", err)
+    }
+
+    return taken, nil
+}
+
+func (s *UserService) UnlinkTelegramID(ctx context.Context, id primitive.ObjectID) error {
+    collection := s.GetCollection("users")
+
+    _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+        "$unset":       bson.M{"telegram_id": ""},
+        "$currentDate": bson.M{"updated_at": true},
+    })
+    if err != nil {
+        return fmt.Errorf("failed to unlink telegram account: %w", err)
+    }
+
+    return nil
+}
+
+// ActivateUser задаёт логин и пароль приглашённому пользователю и переводит его в ACTIVE
+func (s *UserService) ActivateUser(ctx context.Context, id primitive.ObjectID, login, password string) error {
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return fmt.Errorf("failed to hash password: %w", err)
+    }
+
+    collection := s.GetCollection("users")
+    result, err := collection.UpdateOne(ctx,
+        bson.M{"_id": id, "status": models.UserStatusPending},
+        bson.M{
+            "$set": bson.M{
+                "login":    login,
+                "password": string(hashedPassword),
+                "status":   models.UserStatusActive,
+            },
+            "$currentDate": bson.M{"updated_at": true},
+        },
+    )
+    if err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            return ErrLoginTaken
+        }
+        return fmt.Errorf("failed to activate user: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return fmt.Errorf("user %s is not pending activation", id.Hex())
+    }
+
+    return nil
+}
+
 func (s *UserService) CheckPassword(hashedPassword, password string) bool {
     err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
     return err == nil
@@ -136,5 +440,21 @@ func (s *UserService) ChangePassword(ctx context.Context, id primitive.ObjectID,
         return fmt.Errorf("failed to hash password: %w", err)
     }
 
-    return s.UpdateUser(ctx, id, bson.M{"password": string(hashedPassword)})
+    return s.UpdateUser(ctx, id, bson.M{
+        "password":             string(hashedPassword),
+        "must_change_password": false,
+    })
+}
+
+// SetTemporaryPassword задаёт одноразовый пароль, который пользователь обязан сменить при следующем входе
+func (s *UserService) SetTemporaryPassword(ctx context.Context, id primitive.ObjectID, temporaryPassword string) error {
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(temporaryPassword), bcrypt.DefaultCost)
+    if err != nil {
+        return fmt.Errorf("failed to hash password: %w", err)
+    }
+
+    return s.UpdateUser(ctx, id, bson.M{
+        "password":             string(hashedPassword),
+        "must_change_password": true,
+    })
 }
\ No newline at end of file
@@ -3,14 +3,22 @@ package redis
 
 import (
 	"context"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type RedisClient interface {
 	Set(key string, value interface{}) error
+	SetWithTTL(key string, value interface{}, ttl time.Duration) error
+	SetNX(key string, value interface{}, ttl time.Duration) (bool, error)
 	Get(key string) (string, error)
 	Delete(key string) error
+	Expire(key string, ttl time.Duration) error
+	Incr(key string) (int64, error)
+	SAdd(key string, members ...interface{}) error
+	SRem(key string, members ...interface{}) error
+	SMembers(key string) ([]string, error)
 	Publish(ctx context.Context, channel string, message interface{}) error 
 	Subscribe(channels ...string) *redis.PubSub
 }
@@ -27,10 +35,38 @@ func (r *redisClient) Set(key string, value interface{}) error {
 	return r.client.Set(ctx, key, value, 0).Err()
 }
 
+func (r *redisClient) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *redisClient) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
 func (r *redisClient) Get(key string) (string, error) {
 	return r.client.Get(ctx, key).Result()
 }
 
+func (r *redisClient) Expire(key string, ttl time.Duration) error {
+	return r.client.Expire(ctx, key, ttl).Err()
+}
+
+func (r *redisClient) Incr(key string) (int64, error) {
+	return r.client.Incr(ctx, key).Result()
+}
+
+func (r *redisClient) SAdd(key string, members ...interface{}) error {
+	return r.client.SAdd(ctx, key, members...).Err()
+}
+
+func (r *redisClient) SRem(key string, members ...interface{}) error {
+	return r.client.SRem(ctx, key, members...).Err()
+}
+
+func (r *redisClient) SMembers(key string) ([]string, error) {
+	return r.client.SMembers(ctx, key).Result()
+}
+
 
 func (r *redisClient) Publish(ctx context.Context, channel string, message interface{}) error {
 	return r.client.Publish(ctx, channel, message).Err()
@@ -0,0 +1,149 @@
+// redis/login_throttle.go
+package redis
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type LoginThrottleConfig struct {
+	// Число неудачных попыток для одного логина, после которого включается блокировка
+	MaxAttemptsPerLogin int64
+	// То же для одного IP; выше, чтобы не блокировать общий NAT общежития
+	MaxAttemptsPerIP int64
+	// Окно, в течение которого копятся неудачные попытки
+	Window time.Duration
+	// Первая блокировка; каждая следующая попытка удваивает её до MaxLockout
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+type LoginThrottle struct {
+	*RedisService
+	config LoginThrottleConfig
+}
+
+// LoginFailure описывает состояние счётчиков после неудачной попытки входа
+type LoginFailure struct {
+	LoginFailures int64
+	LoginLocked   *time.Time
+	IPLocked      *time.Time
+}
+
+func NewLoginThrottle(redisService *RedisService, config LoginThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{RedisService: redisService, config: config}
+}
+
+func (t *LoginThrottle) MaxAttemptsPerLogin() int64 {
+	return t.config.MaxAttemptsPerLogin
+}
+
+func loginFailuresKey(scope, value string) string {
+	return fmt.Sprintf("login_failures:%s:%s", scope, value)
+}
+
+func loginLockKey(scope, value string) string {
+	return fmt.Sprintf("login_lock:%s:%s", scope, value)
+}
+
+// LockedUntil возвращает момент окончания блокировки логина или IP, если она действует
+func (t *LoginThrottle) LockedUntil(login, ip string) (*time.Time, error) {
+	var latest *time.Time
+	for _, key := range []string{loginLockKey("login", login), loginLockKey("ip", ip)} {
+		until, err := t.readLock(key)
+		if err != nil {
+			return nil, err
+		}
+		if until != nil && (latest == nil || until.After(*latest)) {
+			latest = until
+		}
+	}
+	return latest, nil
+}
+
+func (t *LoginThrottle) RegisterFailure(login, ip string) (*LoginFailure, error) {
+	loginFailures, loginLocked, err := t.registerFailure("login", login, t.config.MaxAttemptsPerLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	_, ipLocked, err := t.registerFailure("ip", ip, t.config.MaxAttemptsPerIP)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginFailure{
+		LoginFailures: loginFailures,
+		LoginLocked:   loginLocked,
+		IPLocked:      ipLocked,
+	}, nil
+}
+
+// Reset сбрасывает счётчик логина после успешного входа. Счётчик IP не сбрасывается,
+// иначе перебор чужих логинов можно было бы обнулять входом в свой аккаунт.
+func (t *LoginThrottle) Reset(login string) error {
+	if err := t.DeleteValue(loginFailuresKey("login", login)); err != nil {
+		return err
+	}
+	return t.DeleteValue(loginLockKey("login", login))
+}
+
+func (t *LoginThrottle) registerFailure(scope, value string, maxAttempts int64) (int64, *time.Time, error) {
+	failuresKey := loginFailuresKey(scope, value)
+
+	failures, err := t.Increment(failuresKey)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to count login failure: %w", err)
+	}
+	if failures == 1 {
+		if err := t.Expire(failuresKey, t.config.Window); err != nil {
+			log.Printf("LoginThrottle: Failed to set window for %s: %v", failuresKey, err)
+		}
+	}
+
+	if failures < maxAttempts {
+		return failures, nil, nil
+	}
+
+	lockout := t.config.BaseLockout << min(failures-maxAttempts, 16)
+	if lockout <= 0 || lockout > t.config.MaxLockout {
+		lockout = t.config.MaxLockout
+	}
+	until := time.Now().Add(lockout)
+
+	if err := t.SetValueWithTTL(loginLockKey(scope, value), until.Unix(), lockout); err != nil {
+		return failures, nil, fmt.Errorf("failed to lock %s: %w", scope, err)
+	}
+	// Окно не должно закончиться раньше блокировки, иначе следующая неудача снова начнёт с BaseLockout
+	if err := t.Expire(failuresKey, lockout+t.config.Window); err != nil {
+		log.Printf("LoginThrottle: Failed to extend window for %s: %v", failuresKey, err)
+	}
+
+	log.Printf("LoginThrottle: %s %q locked for %s after %d failed attempts", scope, value, lockout, failures)
+	return failures, &until, nil
+}
+
+func (t *LoginThrottle) readLock(key string) (*time.Time, error) {
+	value, err := t.GetValue(key)
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read login lock: %w", err)
+	}
+
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode login lock: %w", err)
+	}
+
+	until := time.Unix(unix, 0)
+	if !until.After(time.Now()) {
+		return nil, nil
+	}
+	return &until, nil
+}
@@ -0,0 +1,102 @@
+// redis/refresh_token.go
+package redis
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// Refresh-токены одной сессии образуют семейство: при ротации старый токен помечается
+// использованным, а его повторное предъявление отзывает сессию целиком
+type refreshTokenRecord struct {
+	SessionID string `json:"sessionId"`
+	UserID    string `json:"userId"`
+}
+
+func refreshTokenKey(tokenHash string) string {
+	return fmt.Sprintf("refresh_token:%s", tokenHash)
+}
+
+func refreshTokenUsedKey(tokenHash string) string {
+	return fmt.Sprintf("refresh_token_used:%s", tokenHash)
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *SessionService) IssueRefreshToken(sessionID, userID string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	data, err := json.Marshal(refreshTokenRecord{SessionID: sessionID, UserID: userID})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode refresh token: %w", err)
+	}
+
+	if err := s.SetValueWithTTL(refreshTokenKey(hashRefreshToken(token)), data, ttl); err != nil {
+		return "", fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken погашает предъявленный токен и возвращает сессию, к которой он относится.
+// Новый токен выпускается вызывающим через IssueRefreshToken.
+func (s *SessionService) RotateRefreshToken(token string) (*models.Session, error) {
+	tokenHash := hashRefreshToken(token)
+
+	value, err := s.GetValue(refreshTokenKey(tokenHash))
+	if err == redis.Nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	var record refreshTokenRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode refresh token: %w", err)
+	}
+
+	session, err := s.GetSession(record.SessionID)
+	if err == ErrSessionNotFound {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	firstUse, err := s.SetValueIfAbsent(refreshTokenUsedKey(tokenHash), time.Now().Unix(), time.Until(session.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+	if !firstUse {
+		log.Printf("SessionService: Refresh token reuse detected for session %s of user %s, revoking session", record.SessionID, record.UserID)
+		if err := s.RevokeSession(record.SessionID); err != nil && err != ErrSessionNotFound {
+			log.Printf("SessionService: Failed to revoke session %s after refresh token reuse: %v", record.SessionID, err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return session, nil
+}
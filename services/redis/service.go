@@ -4,6 +4,7 @@ package redis
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -41,11 +42,29 @@ func (s *RedisService) SetValue(key string, value interface{}) error {
 	return nil
 }
 
+func (s *RedisService) SetValueWithTTL(key string, value interface{}, ttl time.Duration) error {
+	err := s.redisClient.SetWithTTL(key, value, ttl)
+	if err != nil {
+		log.Printf("Redis have error when set a value with ttl %v", err)
+		return err
+	}
+	return nil
+}
+
+// SetValueIfAbsent возвращает false, если ключ уже существовал
+func (s *RedisService) SetValueIfAbsent(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return s.redisClient.SetNX(key, value, ttl)
+}
+
 func (s *RedisService) GetValue(key string) (string, error) {
 	value, err := s.redisClient.Get(key)
 	if err == redis.Nil {
 		return "", err
 	}
+	if err != nil {
+		log.Printf("Redis have error when get a value: %v", err)
+		return "", err
+	}
 	return value, nil
 }
 
@@ -58,6 +77,25 @@ func (s *RedisService) DeleteValue(key string) error {
 	return nil
 }
 
+func (s *RedisService) Expire(key string, ttl time.Duration) error {
+	return s.redisClient.Expire(key, ttl)
+}
+
+func (s *RedisService) Increment(key string) (int64, error) {
+	return s.redisClient.Incr(key)
+}
+
+func (s *RedisService) AddToSet(key string, members ...interface{}) error {
+	return s.redisClient.SAdd(key, members...)
+}
+
+func (s *RedisService) RemoveFromSet(key string, members ...interface{}) error {
+	return s.redisClient.SRem(key, members...)
+}
+
+func (s *RedisService) GetSetMembers(key string) ([]string, error) {
+	return s.redisClient.SMembers(key)
+}
 
 func (s *RedisService) Publish(channel string, message interface{}) error {
 	return s.redisClient.Publish(ctx, channel, message)
@@ -0,0 +1,161 @@
+// redis/session_service.go
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DGISsoft/DGISback/models"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Не обновляем lastSeenAt чаще этого интервала, чтобы не писать в Redis на каждый запрос
+const sessionTouchInterval = time.Minute
+
+type SessionService struct {
+	*RedisService
+}
+
+func NewSessionService(redisService *RedisService) *SessionService {
+	return &SessionService{RedisService: redisService}
+}
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+func userSessionsKey(userID string) string {
+	return fmt.Sprintf("user_sessions:%s", userID)
+}
+
+func (s *SessionService) CreateSession(session *models.Session, ttl time.Duration) error {
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(ttl)
+
+	if err := s.saveSession(session, ttl); err != nil {
+		return err
+	}
+
+	if err := s.AddToSet(userSessionsKey(session.UserID), session.ID); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	if err := s.Expire(userSessionsKey(session.UserID), ttl); err != nil {
+		log.Printf("SessionService: Failed to extend session index TTL for user %s: %v", session.UserID, err)
+	}
+
+	log.Printf("SessionService: Created session %s for user %s", session.ID, session.UserID)
+	return nil
+}
+
+func (s *SessionService) GetSession(sessionID string) (*models.Session, error) {
+	value, err := s.GetValue(sessionKey(sessionID))
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (s *SessionService) TouchSession(session *models.Session, ip string) {
+	if time.Since(session.LastSeenAt) < sessionTouchInterval && session.IP == ip {
+		return
+	}
+
+	session.LastSeenAt = time.Now()
+	if ip != "" {
+		session.IP = ip
+	}
+
+	if err := s.saveSession(session, redis.KeepTTL); err != nil {
+		log.Printf("SessionService: Failed to touch session %s: %v", session.ID, err)
+	}
+}
+
+func (s *SessionService) ListUserSessions(userID string) ([]*models.Session, error) {
+	ids, err := s.GetSetMembers(userSessionsKey(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions := make([]*models.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := s.GetSession(id)
+		if err == ErrSessionNotFound {
+			// Сессия истекла по TTL, чистим индекс
+			s.RemoveFromSet(userSessionsKey(userID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (s *SessionService) RevokeSession(sessionID string) error {
+	session, err := s.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.DeleteValue(sessionKey(sessionID)); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	s.RemoveFromSet(userSessionsKey(session.UserID), sessionID)
+
+	log.Printf("SessionService: Revoked session %s of user %s", sessionID, session.UserID)
+	return nil
+}
+
+// RevokeUserSessions завершает все сессии пользователя, кроме exceptSessionID (если задан)
+func (s *SessionService) RevokeUserSessions(userID string, exceptSessionID string) (int, error) {
+	ids, err := s.GetSetMembers(userSessionsKey(userID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	revoked := 0
+	for _, id := range ids {
+		if id == exceptSessionID {
+			continue
+		}
+		if err := s.DeleteValue(sessionKey(id)); err != nil {
+			return revoked, fmt.Errorf("failed to revoke session %s: %w", id, err)
+		}
+		s.RemoveFromSet(userSessionsKey(userID), id)
+		revoked++
+	}
+
+	log.Printf("SessionService: Revoked %d sessions of user %s", revoked, userID)
+	return revoked, nil
+}
+
+func (s *SessionService) saveSession(session *models.Session, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	if err := s.SetValueWithTTL(sessionKey(session.ID), data, ttl); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// redis/two_factor.go
+package redis
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrLoginChallengeInvalid = errors.New("login challenge is invalid or expired")
+
+// Сколько неверных кодов можно ввести по одному challenge, прежде чем он сгорит
+const maxChallengeAttempts = 5
+
+// TwoFactorService хранит challenge второго шага входа и отметки использованных TOTP-кодов
+type TwoFactorService struct {
+	*RedisService
+}
+
+func NewTwoFactorService(redisService *RedisService) *TwoFactorService {
+	return &TwoFactorService{RedisService: redisService}
+}
+
+func loginChallengeKey(tokenHash string) string {
+	return fmt.Sprintf("login_challenge:%s", tokenHash)
+}
+
+func loginChallengeAttemptsKey(tokenHash string) string {
+	return fmt.Sprintf("login_challenge_attempts:%s", tokenHash)
+}
+
+func totpUsedKey(userID string, step int64) string {
+	return fmt.Sprintf("totp_used:%s:%d", userID, step)
+}
+
+func hashChallengeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateChallenge выдаёт токен, подтверждающий, что пароль пользователя userID уже проверен
+func (s *TwoFactorService) CreateChallenge(userID string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate login challenge: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := s.SetValueWithTTL(loginChallengeKey(hashChallengeToken(token)), userID, ttl); err != nil {
+		return "", fmt.Errorf("failed to save login challenge: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *TwoFactorService) GetChallenge(token string) (string, error) {
+	userID, err := s.GetValue(loginChallengeKey(hashChallengeToken(token)))
+	if err == redis.Nil {
+		return "", ErrLoginChallengeInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get login challenge: %w", err)
+	}
+	return userID, nil
+}
+
+// RegisterChallengeFailure учитывает неверный код и удаляет challenge после maxChallengeAttempts попыток
+func (s *TwoFactorService) RegisterChallengeFailure(token string, ttl time.Duration) error {
+	tokenHash := hashChallengeToken(token)
+	attemptsKey := loginChallengeAttemptsKey(tokenHash)
+
+	attempts, err := s.Increment(attemptsKey)
+	if err != nil {
+		return fmt.Errorf("failed to count login challenge attempts: %w", err)
+	}
+	if attempts == 1 {
+		if err := s.Expire(attemptsKey, ttl); err != nil {
+			return fmt.Errorf("failed to set login challenge attempts ttl: %w", err)
+		}
+	}
+
+	if attempts >= maxChallengeAttempts {
+		return s.DeleteChallenge(token)
+	}
+	return nil
+}
+
+func (s *TwoFactorService) DeleteChallenge(token string) error {
+	tokenHash := hashChallengeToken(token)
+	if err := s.DeleteValue(loginChallengeKey(tokenHash)); err != nil {
+		return fmt.Errorf("failed to delete login challenge: %w", err)
+	}
+	if err := s.DeleteValue(loginChallengeAttemptsKey(tokenHash)); err != nil {
+		return fmt.Errorf("failed to delete login challenge attempts: %w", err)
+	}
+	return nil
+}
+
+// MarkCodeUsed не даёт повторно предъявить TOTP-код того же шага; false — код уже использовался
+func (s *TwoFactorService) MarkCodeUsed(userID string, step int64, ttl time.Duration) (bool, error) {
+	firstUse, err := s.SetValueIfAbsent(totpUsedKey(userID, step), time.Now().Unix(), ttl)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark totp code as used: %w", err)
+	}
+	return firstUse, nil
+}